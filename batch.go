@@ -0,0 +1,99 @@
+package cyberetrieve
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+// BatchResult is a result of a batch retrieve, tagged with the query which produced it
+type BatchResult struct {
+	sources.Result
+
+	// QueryIndex is the index of the query in the batch
+	QueryIndex int
+
+	// Query is the query which produced the result
+	Query *sources.Query
+}
+
+// RetrieveBatch searches the queries with the same providers.
+// Sessions are checked once, at most WithConcurrency searches run at a time,
+// and results are unique among all queries, a result is tagged with the first query which found it
+func (c *CyberRetrieveEngine) RetrieveBatch(queries []sources.Query) ([]BatchResult, error) {
+	return c.RetrieveBatchContext(context.Background(), queries)
+}
+
+// RetrieveBatchContext is RetrieveBatch which stops searching once ctx is done,
+// the results found so far are returned with ctx.Err()
+func (c *CyberRetrieveEngine) RetrieveBatchContext(ctx context.Context, queries []sources.Query) ([]BatchResult, error) {
+	batch := make([]*sources.Query, len(queries))
+	for i := range queries {
+		query := queries[i]
+		batch[i] = &query
+	}
+
+	tasks, report, err := c.prepare(ctx, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BatchResult, 0)
+	err = c.run(ctx, tasks, report, nil, func(task searchTask, item sources.Result) error {
+		results = append(results, BatchResult{
+			Result:     item,
+			QueryIndex: task.index,
+			Query:      batch[task.index],
+		})
+		return nil
+	})
+	return results, err
+}
+
+// TemplateTarget is the template variable set to each target by RetrieveTemplate
+const TemplateTarget = "target"
+
+// ExpandTemplate returns the template query executed once per target,
+// with {{target}} set to the target and the other variables from vars.
+// Values are escaped with the grammar of each enabled provider
+func (c *CyberRetrieveEngine) ExpandTemplate(template sources.Query, vars map[string]string, targets []string) ([]sources.Query, error) {
+	providers := c.providers
+	grammars := make([]*sources.Grammar, 0, len(providers))
+	for _, provider := range providers {
+		if grammar := provider.Grammar(); grammar != nil {
+			grammars = append(grammars, grammar)
+		}
+	}
+
+	queries := make([]sources.Query, 0, len(targets))
+	for _, target := range targets {
+		targetVars := make(map[string]string, len(vars)+1)
+		for name, value := range vars {
+			targetVars[name] = value
+		}
+		targetVars[TemplateTarget] = target
+
+		query, err := template.Execute(targetVars, grammars...)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", target, err)
+		}
+		queries = append(queries, query)
+	}
+	return queries, nil
+}
+
+// RetrieveTemplate expands the template query over the targets with ExpandTemplate,
+// then searches the queries as a batch
+func (c *CyberRetrieveEngine) RetrieveTemplate(template sources.Query, vars map[string]string, targets []string) ([]BatchResult, error) {
+	return c.RetrieveTemplateContext(context.Background(), template, vars, targets)
+}
+
+// RetrieveTemplateContext is RetrieveTemplate which stops searching once ctx is done
+func (c *CyberRetrieveEngine) RetrieveTemplateContext(ctx context.Context, template sources.Query, vars map[string]string, targets []string) ([]BatchResult, error) {
+	queries, err := c.ExpandTemplate(template, vars, targets)
+	if err != nil {
+		return nil, err
+	}
+	return c.RetrieveBatchContext(ctx, queries)
+}
@@ -0,0 +1,36 @@
+package cyberetrieve
+
+import (
+	"testing"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+func TestRetrieveBatchWithoutSearch(t *testing.T) {
+	queries := []sources.Query{{Query: `ip:"1.1.1.1"`, NumberOfQuery: 10}}
+	tests := []struct {
+		name    string
+		options []EngineOption
+		queries []sources.Query
+	}{
+		{"empty batch", nil, nil},
+		{"dry run", []EngineOption{WithDryRun()}, queries},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := NewEngine(sources.Session{}, append([]EngineOption{WithFofaSearch()}, tt.options...)...)
+			results, err := engine.RetrieveBatch(tt.queries)
+			if err != nil {
+				t.Fatalf("RetrieveBatch() error = %v", err)
+			}
+			if len(results) != 0 {
+				t.Errorf("RetrieveBatch() = %d results, want none", len(results))
+			}
+
+			results, err = engine.RetrieveTemplate(sources.Query{Query: `ip:"{{target}}"`, NumberOfQuery: 10}, nil, nil)
+			if err != nil || len(results) != 0 {
+				t.Errorf("RetrieveTemplate() = %d results, %v, want none", len(results), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package cyberetrieve
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+// DedupStrategy returns the key the results are deduplicated on, the first result of a key is kept.
+// An empty key falls back to the exact result
+type DedupStrategy func(result sources.Result) string
+
+// DedupExact keeps the results which differ in any asset field, it's the default strategy.
+// Provider, Timestamp, Raw and Sources are ignored, but the providers rarely return the same
+// title, url or host for an asset, use DedupByIPPort or DedupByURL to drop the duplicates among providers
+func DedupExact(result sources.Result) string {
+	result.Provider = ""
+	result.Timestamp = time.Time{}
+	result.Raw = nil
+	result.Sources = nil
+	return fmt.Sprintf("%#v", result)
+}
+
+// DedupByIPPort keeps one result per ip:port, the host is used when the ip is unknown
+func DedupByIPPort(result sources.Result) string {
+	host := result.IP
+	if host == "" {
+		host = sources.NormalizeHost(result.Host)
+		if host == "" {
+			host = sources.NormalizeHost(result.URL)
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	if host == "" || result.Port == 0 {
+		return ""
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(result.Port))
+}
+
+// DedupByURL keeps one result per normalized url, see sources.NormalizeURL
+func DedupByURL(result sources.Result) string {
+	return sources.NormalizeURL(result.URL)
+}
+
+// DedupByHost keeps one result per normalized host, from the host or the url, see sources.NormalizeHost
+func DedupByHost(result sources.Result) string {
+	if host := sources.NormalizeHost(result.Host); host != "" {
+		return host
+	}
+	return sources.NormalizeHost(result.URL)
+}
+
+// DedupByDomain keeps one result per lowercase domain, results without domain are kept
+func DedupByDomain(result sources.Result) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(result.Domain)), ".")
+}
+
+// WithDedup this function is used to set the strategy the results are deduplicated with,
+// e.g. WithDedup(DedupByIPPort), or a function returning the key of a result.
+// Default is DedupExact
+func WithDedup(strategy DedupStrategy) EngineOption {
+	return func(c *CyberRetrieveEngine) {
+		c.dedup = strategy
+	}
+}
+
+// WithMerge this function is used to merge the duplicates into one result instead of dropping them,
+// the empty fields are filled from the duplicates and Sources lists every provider which found it.
+// The merged results are sent when every provider search has ended
+func WithMerge() EngineOption {
+	return func(c *CyberRetrieveEngine) {
+		c.isMerge = true
+	}
+}
+
+// dedupKey returns the key the result is deduplicated on
+func (c *CyberRetrieveEngine) dedupKey(result sources.Result) string {
+	if c.dedup != nil {
+		if key := c.dedup(result); key != "" {
+			return key
+		}
+	}
+	return DedupExact(result)
+}
@@ -0,0 +1,53 @@
+package cyberetrieve
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+func TestDedupKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy DedupStrategy
+		a, b     sources.Result
+		same     bool
+	}{
+		{"ip port", DedupByIPPort, sources.Result{IP: "1.1.1.1", Port: 80, Title: "a"}, sources.Result{IP: "1.1.1.1", Port: 80, Title: "b"}, true},
+		{"ip other port", DedupByIPPort, sources.Result{IP: "1.1.1.1", Port: 80}, sources.Result{IP: "1.1.1.1", Port: 443}, false},
+		{"host for ip", DedupByIPPort, sources.Result{Host: "Example.com:8080", Port: 8080}, sources.Result{URL: "http://example.com:8080/a", Port: 8080}, true},
+		{"url", DedupByURL, sources.Result{URL: "HTTPS://Example.com:443/a/"}, sources.Result{URL: "https://example.com/a"}, true},
+		{"url scheme", DedupByURL, sources.Result{URL: "http://example.com"}, sources.Result{URL: "https://example.com"}, false},
+		{"host", DedupByHost, sources.Result{Host: "example.com:80"}, sources.Result{URL: "http://Example.com/a"}, true},
+		{"host port", DedupByHost, sources.Result{Host: "example.com:8080"}, sources.Result{Host: "example.com"}, false},
+		{"domain", DedupByDomain, sources.Result{Domain: "Example.com."}, sources.Result{Domain: "example.com"}, true},
+		{"exact provenance", DedupExact,
+			sources.Result{IP: "1.1.1.1", Port: 80, Provider: "FOFA", Timestamp: time.Now(), Raw: json.RawMessage(`{}`)},
+			sources.Result{IP: "1.1.1.1", Port: 80, Provider: "QUAKE", Sources: []sources.Source{{Provider: "QUAKE"}}}, true},
+		{"exact field", DedupExact, sources.Result{IP: "1.1.1.1", Port: 80, Title: "a"}, sources.Result{IP: "1.1.1.1", Port: 80, Title: "b"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := tt.strategy(tt.a), tt.strategy(tt.b)
+			if a == "" || b == "" {
+				t.Fatalf("keys %q and %q, want non empty keys", a, b)
+			}
+			if (a == b) != tt.same {
+				t.Errorf("keys %q and %q, want same = %v", a, b, tt.same)
+			}
+		})
+	}
+}
+
+func TestDedupKeyFallback(t *testing.T) {
+	engine := NewEngine(sources.Session{}, WithDedup(DedupByIPPort))
+	results := []sources.Result{{Title: "a"}, {Title: "b"}}
+	if engine.dedupKey(results[0]) == engine.dedupKey(results[1]) {
+		t.Errorf("results without ip and port share a key, want the exact result as key")
+	}
+	if DedupByIPPort(results[0]) != "" || DedupByURL(results[0]) != "" || DedupByHost(results[0]) != "" || DedupByDomain(results[0]) != "" {
+		t.Errorf("empty result has a key, want an empty key")
+	}
+}
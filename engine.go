@@ -1,10 +1,13 @@
 package cyberetrieve
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/N0el4kLs/cyberetrieve/sources"
 	"github.com/N0el4kLs/cyberetrieve/sources/fofa"
@@ -14,46 +17,63 @@ import (
 	"github.com/projectdiscovery/gologger"
 )
 
+// EngineMode is the former bitmask of the enabled providers.
+//
+// Deprecated: EngineMode does nothing, providers are enabled by name with WithProvider
 type EngineMode uint8
 
+// Deprecated: the modes do nothing, use WithProvider, e.g. WithProvider(quake.QUAKE)
 const (
 	ModeQuake EngineMode = 1 << (8 - 1 - iota)
 	ModeFofa
 	ModeHunter
 )
 
+// DEFAULT_CONCURRENCY is the default max number of searches running at a time
+const DEFAULT_CONCURRENCY = 3
+
+// TranslatePolicy decides what to do with a provider
+// which can't translate the neutral query
+type TranslatePolicy uint8
+
+const (
+	// TranslateFail fails the search before any provider is called
+	TranslateFail TranslatePolicy = iota
+	// TranslateSkip leaves the provider out and searches with the others
+	TranslateSkip
+)
+
 // EngineOption is a type for setting options for the engine
 type EngineOption func(c *CyberRetrieveEngine)
 
-// CyberRetrieveEngine is the main struct for the engine
+// CyberRetrieveEngine is the main struct for the engine.
+// It can be used for many searches, concurrently, the sessions are checked once
 type CyberRetrieveEngine struct {
 	// Query is the query struct
-	// that contains the different engines query to search
+	// that contains the different engines query to search,
+	// it's the query of the Retrieve methods
 	Query *sources.Query
 
-	//
-	channelBuffer int
+	// providerNames is the names of the enabled providers, see sources.RegisterProvider
+	// e.g. QUAKE, FOFA
+	providerNames []string
+
+	// providerErr is the error of enabling the providers, e.g. an unknown provider name
+	providerErr error
 
-	// searchMode is the mode of the search engine
-	// e.g. quake, fofa
-	searchMode EngineMode
+	// providerOptions is the options of the configurable providers, by upper case provider name
+	providerOptions map[string]interface{}
 
 	// sessions is the session for the providers
 	sessions *sources.Session
 
-	// providers is the list of providers
+	// providers is the list of providers chosen by the search mode
 	providers []sources.Provider
 
-	// providerLock is the lock for the providers
-	providerWg *sync.WaitGroup
-
-	// resultChannel is the channel for results
-	resultChannel chan sources.Result
+	// auths is the authorization state of each provider
+	auths map[string]*providerAuth
 
-	// resultSlice is the slice of results
-	resultSlice []sources.Result
-
-	// mutex for save result into resultSlice
+	// mutex for save the report of the last retrieve
 	mutex *sync.Mutex
 
 	// isAutoGrammar is the flag to enable auto grammar,
@@ -61,36 +81,60 @@ type CyberRetrieveEngine struct {
 	isAutoGrammar bool
 
 	// isDeepSearch is the flag to enable deep search
-	// which will cost many points to detect corresponding targets as many as possible
-	// now not support in Query.Query,
-	// only support in Query.QuakeQuery, Query.FofaQuery, Query.HunterQuery
+	// which will cost many points to detect corresponding targets as many as possible,
+	// the terms of the query are widened by the expanders.
 	// when use deep search mode, unlimited query number
 	isDeepSearch bool
+
+	// expanders is the names of the expanders used by deep search
+	expanders []string
+
+	// translatePolicy decides what to do with a provider which can't translate the query
+	translatePolicy TranslatePolicy
+
+	// isDryRun is the flag to only log the search plan, no provider API is called
+	isDryRun bool
+
+	// concurrency is the max number of searches of a run running at a time, 0 means unlimited
+	concurrency int
+
+	// dedup is the strategy the results are deduplicated with, nil means DedupExact
+	dedup DedupStrategy
+
+	// isMerge is the flag to merge the duplicated results instead of dropping them
+	isMerge bool
+
+	// report is the outcome of each provider search of the last retrieve
+	report *Report
+}
+
+// providerAuth is the authorization state of a provider
+type providerAuth struct {
+	mutex   sync.Mutex
+	checked bool
+	ok      bool
 }
 
-// NewCyberRetrieveEngine creates a new cyber retrieve engine
+// NewCyberRetrieveEngine creates a new cyber retrieve engine for the query of the Retrieve methods
 func NewCyberRetrieveEngine(query sources.Query, session sources.Session, engineOptions ...EngineOption) *CyberRetrieveEngine {
-	bufSize := query.NumberOfQuery
-	if bufSize < 0 {
+	if query.NumberOfQuery < 0 {
 		gologger.Fatal().Msgf("query number can't below 0")
 	}
 
-	if bufSize > 1000 {
-		bufSize = bufSize / 50
-	} else if 3 < bufSize && bufSize < 500 {
-		bufSize = bufSize / 3
-	}
+	engine := NewEngine(session, engineOptions...)
+	engine.Query = &query
+	return engine
+}
 
+// NewEngine creates a new cyber retrieve engine without query, use Search to search queries.
+// The sessions are checked on the first search needing them
+func NewEngine(session sources.Session, engineOptions ...EngineOption) *CyberRetrieveEngine {
 	engine := &CyberRetrieveEngine{
-		Query:         &query,
-		channelBuffer: bufSize,
 		sessions:      &session,
-		providers:     make([]sources.Provider, 0, 2),
-		providerWg:    &sync.WaitGroup{},
-		resultChannel: make(chan sources.Result, bufSize),
 		mutex:         &sync.Mutex{},
 		isAutoGrammar: false,
 		isDeepSearch:  false,
+		concurrency:   DEFAULT_CONCURRENCY,
 	}
 	if len(engineOptions) != 0 {
 		for _, opt := range engineOptions {
@@ -98,68 +142,71 @@ func NewCyberRetrieveEngine(query sources.Query, session sources.Session, engine
 		}
 	}
 
-	// set deep search grammar
-	if engine.isDeepSearch {
-
-		// when use deep search mode, unlimited query number
-		engine.Query.NumberOfQuery = -1
-
-		// Todo only handle single keyword now, need to handle multiple keywords later
-		if strings.Contains(engine.Query.Query, "domain") {
-			d := strings.Split(engine.Query.Query, ":")[1]
-			// remove the double quote
-			d = d[1 : len(d)-1]
-			engine.Query.Query = fmt.Sprintf(`%s OR cert:"%s"`, engine.Query.Query, d)
-		}
-
-		if engine.searchMode&ModeQuake == ModeQuake {
-			if strings.Contains(engine.Query.QuakeQuery, "domain") {
-				d := strings.Split(engine.Query.QuakeQuery, ":")[1]
-				// remove the double quote
-				d = d[1 : len(d)-1]
-				engine.Query.QuakeQuery = fmt.Sprintf(`%s OR cert:"%s"`, engine.Query.QuakeQuery, d)
-			}
-		}
-
-		if engine.searchMode&ModeFofa == ModeFofa {
-			if strings.Contains(engine.Query.FofaQuery, "domain") {
-				d := strings.Split(engine.Query.FofaQuery, "=")[1]
-				// remove the double quote
-				d = d[1 : len(d)-1]
-				engine.Query.FofaQuery = fmt.Sprintf(`%s || cert="%s"`, engine.Query.FofaQuery, d)
-			}
-		}
+	engine.providers, engine.providerErr = engine.enabledProviders()
+	engine.auths = make(map[string]*providerAuth, len(engine.providers))
+	for _, provider := range engine.providers {
+		engine.auths[provider.Name()] = &providerAuth{}
+	}
+	return engine
+}
 
-		if engine.searchMode&ModeHunter == ModeHunter {
-			if strings.Contains(engine.Query.HunterQuery, "domain") {
-				d := strings.Split(engine.Query.HunterQuery, "=")[1]
-				// remove the double quote
-				d = d[1 : len(d)-1]
-				engine.Query.HunterQuery = fmt.Sprintf(`%s || cert="%s"`, engine.Query.HunterQuery, d)
-			}
-		}
+// bufferSize returns the size of the result buffers to fetch numberOfQuery results
+func bufferSize(numberOfQuery int) int {
+	bufSize := numberOfQuery
+	if bufSize < 0 { // unlimited
+		bufSize = sources.DEFAULT_PAGE_SIZE_MAX
 	}
 
-	return engine
+	if bufSize > 1000 {
+		bufSize = bufSize / 50
+	} else if 3 < bufSize && bufSize < 500 {
+		bufSize = bufSize / 3
+	}
+	return bufSize
 }
 
 // WithFofaSearch this function is used to set the search mode to fofa
 func WithFofaSearch() EngineOption {
 	return func(c *CyberRetrieveEngine) {
-		c.searchMode = c.searchMode | ModeFofa
+		WithProvider(fofa.FOFA)(c)
 	}
 }
 
 // WithQuakeSearch this function is used to set the search mode to quake
 func WithQuakeSearch() EngineOption {
 	return func(c *CyberRetrieveEngine) {
-		c.searchMode = c.searchMode | ModeQuake
+		WithProvider(quake.QUAKE)(c)
 	}
 }
 
+// WithHunterSearch this function is used to set the search mode to hunter
 func WithHunterSearch() EngineOption {
 	return func(c *CyberRetrieveEngine) {
-		c.searchMode = c.searchMode | ModeHunter
+		WithProvider(hunter.HUNTER)(c)
+	}
+}
+
+// WithProvider this function is used to enable registered providers by name, case-insensitively,
+// e.g. WithProvider("fofa"). A third-party provider is registered by importing its package,
+// see sources.RegisterProvider
+func WithProvider(names ...string) EngineOption {
+	return func(c *CyberRetrieveEngine) {
+		for _, name := range names {
+			if !slices.ContainsFunc(c.providerNames, func(n string) bool { return strings.EqualFold(n, name) }) {
+				c.providerNames = append(c.providerNames, name)
+			}
+		}
+	}
+}
+
+// WithProviderOptions this function is used to set the options of a provider, e.g. fofa.Options,
+// the provider must implement sources.Configurable
+func WithProviderOptions(name string, options interface{}) EngineOption {
+	return func(c *CyberRetrieveEngine) {
+		if c.providerOptions == nil {
+			c.providerOptions = make(map[string]interface{})
+		}
+		c.providerOptions[strings.ToUpper(name)] = options
 	}
 }
 
@@ -170,193 +217,627 @@ func WithAutoGrammar() EngineOption {
 	}
 }
 
-// WithDeepSearch this function is used to set the deep search option
-func WithDeepSearch() EngineOption {
+// WithDeepSearch this function is used to set the deep search option,
+// the query terms are widened by the named expanders, see sources.Expanders.
+// domain-cert is used when no expander is named
+func WithDeepSearch(expanders ...string) EngineOption {
 	return func(c *CyberRetrieveEngine) {
 		c.isDeepSearch = true
+		if len(expanders) == 0 {
+			expanders = []string{"domain-cert"}
+		}
+		c.expanders = append(c.expanders, expanders...)
 	}
 }
 
-// RetrieveWithChannel this function return the result with chan Result  type
-func (c *CyberRetrieveEngine) RetrieveWithChannel() (chan sources.Result, error) {
-	if err := c.retrieve(); err != nil {
-		// Todo handle this return value if err happened in retrieve
-		return c.resultChannel, err
-	} else {
-		return c.resultChannel, nil
+// WithTranslatePolicy this function is used to set what to do with a provider
+// which can't translate the neutral query, default is TranslateFail
+func WithTranslatePolicy(policy TranslatePolicy) EngineOption {
+	return func(c *CyberRetrieveEngine) {
+		c.translatePolicy = policy
+	}
+}
+
+// WithDryRun this function is used to only log the search plan without calling any provider API,
+// the retrieve methods return no result. Use Plan to get the plan directly
+func WithDryRun() EngineOption {
+	return func(c *CyberRetrieveEngine) {
+		c.isDryRun = true
 	}
 }
 
+// WithConcurrency this function is used to set the max number of searches running at a time
+// among all providers and queries of a run or batch, default is DEFAULT_CONCURRENCY.
+// Each run has its own limit, so a run whose results are not read doesn't stall the others
+func WithConcurrency(concurrency int) EngineOption {
+	return func(c *CyberRetrieveEngine) {
+		c.concurrency = concurrency
+	}
+}
+
+// RetrieveWithChannel this function return the result with chan Result  type,
+// it returns once the query is planned and the results are sent as the providers fetch them.
+// The channel is closed when the search ends, use Report to know how it ended
+func (c *CyberRetrieveEngine) RetrieveWithChannel() (chan sources.Result, error) {
+	return c.RetrieveWithChannelContext(context.Background())
+}
+
+// RetrieveWithChannelContext is RetrieveWithChannel which stops searching once ctx is done
+func (c *CyberRetrieveEngine) RetrieveWithChannelContext(ctx context.Context) (chan sources.Result, error) {
+	results := make(chan sources.Result, bufferSize(c.queryNumber()))
+	_, err := c.start(ctx, c.Query, &channelSink{ctx: ctx, results: results}, nil)
+	return results, err
+}
+
+// RetrieveStream is RetrieveWithChannelContext with the events of the search,
+// which tell the progress of each provider while the search is running.
+// The events channel is closed after the results channel, with EventDone as the last event
+func (c *CyberRetrieveEngine) RetrieveStream(ctx context.Context) (<-chan sources.Result, <-chan Event, error) {
+	run, err := c.search(ctx, c.Query)
+	return run.Results, run.Events, err
+}
+
 // RetrieveResult this function return the result with []sources.Result slice type
 func (c *CyberRetrieveEngine) RetrieveResult() ([]sources.Result, error) {
-	// avoiding resultChannel block
+	return c.RetrieveResultContext(context.Background())
+}
+
+// RetrieveResultContext is RetrieveResult which stops searching once ctx is done,
+// the results found so far are returned with ctx.Err()
+func (c *CyberRetrieveEngine) RetrieveResultContext(ctx context.Context) ([]sources.Result, error) {
+	sink := &sliceSink{}
+	err := c.RetrieveWithSink(ctx, sink)
+	return sink.results, err
+}
+
+// Quota returns the last reported quota of the enabled provider of the name,
+// false if the provider doesn't report its quota, see sources.QuotaReporter
+func (c *CyberRetrieveEngine) Quota(name string) (sources.Quota, bool) {
+	for _, provider := range c.providers {
+		if !strings.EqualFold(provider.Name(), name) {
+			continue
+		}
+		if reporter, ok := provider.(sources.QuotaReporter); ok {
+			return reporter.Quota(), true
+		}
+	}
+	return sources.Quota{}, false
+}
+
+// Report returns how the search of each provider ended in the last retrieve,
+// or nil if no search was run
+func (c *CyberRetrieveEngine) Report() *Report {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.report
+}
+
+// queryNumber returns the number of results asked by the query of the Retrieve methods
+func (c *CyberRetrieveEngine) queryNumber() int {
+	if c.Query == nil {
+		return 0
+	}
+	return c.Query.NumberOfQuery
+}
+
+// start plans the query, then checks the sessions and searches in the background.
+// The results are put into the sink, a channel sink is closed when the search ends,
+// then the events are closed and the run ends with the error of the search.
+// The error of the plan is returned at once
+func (c *CyberRetrieveEngine) start(ctx context.Context, query *sources.Query, sink ResultSink, events chan Event) (*Run, error) {
+	done := make(chan error, 1)
+	run := &Run{Events: events, done: done}
+	if cs, ok := sink.(*channelSink); ok {
+		run.Results = cs.results
+	}
+	finish := func(report *Report, err error) {
+		run.report = report
+		if cs, ok := sink.(*channelSink); ok {
+			close(cs.results)
+		}
+		sendEvent(events, Event{Kind: EventDone, Report: report, Err: err})
+		if events != nil {
+			close(events)
+		}
+		done <- err
+	}
+
+	if query == nil {
+		err := errors.New("the engine has no query, use Search")
+		finish(nil, err)
+		return run, err
+	}
+	plans, err := c.planQueries(ctx, []*sources.Query{query})
+	if err != nil || len(plans) == 0 {
+		finish(nil, err)
+		return run, err
+	}
+
 	go func() {
-		for {
-			_, ok := <-c.resultChannel
-			if !ok {
-				break
-			}
+		tasks, report, err := c.authorize(ctx, events, plans)
+		if err != nil || len(tasks) == 0 {
+			finish(report, err)
+			return
 		}
+
+		err = c.run(ctx, tasks, report, events, func(_ searchTask, item sources.Result) error {
+			return sink.Put(item)
+		})
+		finish(report, err)
 	}()
+	return run, nil
+}
 
-	if err := c.retrieve(); err != nil {
-		// Todo handle this return value if err happened in retrieve
-		return c.resultSlice, err
-	} else {
-		return c.resultSlice, nil
+// searchTask is the search of a query by a provider
+type searchTask struct {
+	index    int // index of the query in the batch
+	query    *sources.Query
+	provider sources.Provider
+}
+
+// prepare plans the queries and checks the sessions once for all of them,
+// then returns the searches to run, with the report of the run holding the authorization failures.
+// No search is returned in dry run mode, or for no query, the report is never nil
+func (c *CyberRetrieveEngine) prepare(ctx context.Context, queries []*sources.Query) ([]searchTask, *Report, error) {
+	// plan before authorization, so an untranslatable query spends no quota
+	plans, err := c.planQueries(ctx, queries)
+	if err != nil || len(plans) == 0 {
+		return nil, &Report{}, err
 	}
+	return c.authorize(ctx, nil, plans)
 }
 
-func (c *CyberRetrieveEngine) retrieve() error {
-	if err := c.checkSession(); err != nil {
-		return err
+// planQueries plans the queries, no plan is returned in dry run mode
+func (c *CyberRetrieveEngine) planQueries(ctx context.Context, queries []*sources.Query) ([]*Plan, error) {
+	plans := make([]*Plan, 0, len(queries))
+	for i, query := range queries {
+		// a dry run only logs the plan, the remote expanders are not called
+		plan, err := c.plan(ctx, query, !c.isDryRun)
+		if err != nil {
+			if len(queries) > 1 {
+				err = fmt.Errorf("query #%d: %w", i, err)
+			}
+			return nil, err
+		}
+		for _, pp := range plan.Providers {
+			if pp.Skipped {
+				gologger.Warning().Msgf("Skip %s: %s\n", pp.Name, pp.Err)
+			}
+		}
+		plans = append(plans, plan)
+	}
+	if c.isDryRun {
+		for _, plan := range plans {
+			gologger.Info().Msgf("Dry run, the search plan is:\n%s", plan)
+		}
+		return nil, nil
 	}
+	return plans, nil
+}
 
-	var (
-		tmpRstsBroker = make(chan *sources.Result, c.channelBuffer)
-	)
+// authorize checks the sessions once for all the plans, then returns the searches to run,
+// with the report of the run holding the authorization failures
+func (c *CyberRetrieveEngine) authorize(ctx context.Context, events chan Event, plans []*Plan) ([]searchTask, *Report, error) {
+	report := &Report{}
+	providers, authFailures, err := c.checkSession(ctx, plans...)
+	report.Outcomes = append(report.Outcomes, authFailures...)
+	for i := range authFailures {
+		sendEvent(events, Event{Kind: EventSearchEnd, Provider: authFailures[i].Provider, Outcome: &authFailures[i]})
+	}
+	if err != nil {
+		c.setReport(report)
+		return nil, report, err
+	}
+
+	var tasks []searchTask
+	for i, plan := range plans {
+		queries := plan.queries()
+		for _, provider := range providers {
+			if query, ok := queries[provider.Name()]; ok {
+				tasks = append(tasks, searchTask{index: i, query: query, provider: provider})
+			}
+		}
+	}
+	return tasks, report, nil
+}
 
-	for _, prd := range c.providers {
-		c.providerWg.Add(1)
+// setReport saves the report of the last retrieve
+func (c *CyberRetrieveEngine) setReport(report *Report) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.report = report
+}
 
-		go func(provider sources.Provider) {
-			defer c.providerWg.Done()
+// run searches the tasks, at most c.concurrency searches of the run at a time,
+// the results unique among all tasks are passed to emit, an emit error stops the search and is returned.
+// The outcome of each task is added to the report, which is saved as the report of the engine,
+// and the start and end of each task are sent to events, if any.
+// Once ctx is done, no result is emitted anymore and ctx.Err() is returned
+// when every search goroutine has exited. If every task failed, their errors are returned
+func (c *CyberRetrieveEngine) run(ctx context.Context, tasks []searchTask, report *Report, events chan Event, emit func(task searchTask, result sources.Result) error) error {
+	// a failing result consumer cancels the searches with its error as the cause
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	type taskResult struct {
+		task   searchTask
+		result *sources.Result
+	}
 
-			query := c.Query
-			queryMap := map[string]string{
-				quake.QUAKE:   query.QuakeQuery,
-				fofa.FOFA:     query.FofaQuery,
-				hunter.HUNTER: query.HunterQuery,
-			}
+	bufSize := 0
+	for _, task := range tasks {
+		bufSize = max(bufSize, bufferSize(task.query.NumberOfQuery))
+	}
 
-			// if autoGrammar is on, and corresponding engine's query is empty,
-			// then transfer the default query into the corresponding format
-			if c.isAutoGrammar && queryMap[provider.Name()] == "" {
-				prdGrammar := c.autoGrammar(query.Query, provider.Name())
-				if prdGrammar != "" {
-					switch provider.Name() {
-					case quake.QUAKE:
-						query.QuakeQuery = prdGrammar
-					case fofa.FOFA:
-						query.FofaQuery = prdGrammar
-					case hunter.HUNTER:
-						query.HunterQuery = prdGrammar
-					}
-					//gologger.Info().Msgf("Provider %s search grammar: %s\n", provider.Name(), prdGrammar)
+	var (
+		wg            sync.WaitGroup
+		tmpRstsBroker = make(chan taskResult, bufSize)
+	)
+	outcomes := make([]Outcome, len(tasks))
+
+	// the limit is per run, a run whose results are not read only blocks its own searches
+	var semaphore chan struct{}
+	if c.concurrency > 0 {
+		semaphore = make(chan struct{}, c.concurrency)
+	}
+
+	for i, task := range tasks {
+		wg.Add(1)
+
+		go func(i int, task searchTask) {
+			var (
+				found  int
+				err    error
+				stream *sources.Stream
+			)
+			defer wg.Done()
+			defer func() {
+				if err != nil && errors.Is(err, ctx.Err()) {
+					err = context.Cause(ctx)
+				}
+				outcomes[i] = newOutcome(task.provider.Name(), task.index, found, err)
+				if stream != nil {
+					outcomes[i].Warnings = stream.Warnings()
+				}
+				outcome := outcomes[i]
+				sendEvent(events, Event{Kind: EventSearchEnd, Provider: outcome.Provider, QueryIndex: task.index, Outcome: &outcome})
+			}()
+
+			if semaphore != nil {
+				select {
+				case semaphore <- struct{}{}:
+				case <-ctx.Done():
+					err = ctx.Err()
+					return
 				}
+				defer func() { <-semaphore }()
 			}
 
-			rstChannel, err := provider.Search(query)
+			sendEvent(events, Event{Kind: EventSearchStart, Provider: task.provider.Name(), QueryIndex: task.index})
+			stream, err = task.provider.Search(ctx, task.query)
 			if err != nil {
-				// Todo do something to handle the error
+				stream = nil
 				return
 			}
-			for result := range rstChannel {
-				tmpRstsBroker <- result
+			for result := range stream.Results {
+				found++
+				select {
+				case tmpRstsBroker <- taskResult{task: task, result: result}:
+				case <-ctx.Done():
+					// the provider stops sending on ctx.Done too,
+					// its warnings are only valid once the stream is closed
+					err = ctx.Err()
+					stream = nil
+					return
+				}
 			}
-		}(prd)
+			err = stream.Err()
+		}(i, task)
 	}
 
 	go func() {
-		c.providerWg.Wait()
+		wg.Wait()
 		close(tmpRstsBroker)
 	}()
 
-	// Unique results
-	tmpList := make(map[sources.Result]struct{})
+	// Unique results, merged ones are emitted when every search has ended
+	var (
+		emitErr error
+		merged  []taskResult
+	)
+	tmpList := make(map[string]int) // key -> index in merged
 	for item := range tmpRstsBroker {
-		if _, ok := tmpList[*item]; !ok {
-			tmpList[*item] = struct{}{}
-			c.resultChannel <- *item
-
-			c.mutex.Lock()
-			c.resultSlice = append(c.resultSlice, *item)
-			c.mutex.Unlock()
+		if ctx.Err() != nil {
+			continue
+		}
+		item.result.AddSource(sources.Source{Provider: item.task.provider.Name(), SeenAt: time.Now()})
+		key := c.dedupKey(*item.result)
+		if i, ok := tmpList[key]; ok {
+			if c.isMerge {
+				merged[i].result.Merge(*item.result)
+			}
+			continue
+		}
+		tmpList[key] = len(merged)
+		if c.isMerge {
+			merged = append(merged, item)
+			continue
+		}
+		if err := emit(item.task, *item.result); err != nil && ctx.Err() == nil {
+			// stop the searches, the remaining results are drained
+			emitErr = err
+			cancel(fmt.Errorf("stopped, handling a result failed: %w", err))
+		}
+	}
+	for _, item := range merged {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := emit(item.task, *item.result); err != nil {
+			emitErr = err
+			break
 		}
 	}
-	close(c.resultChannel)
 
+	report.Outcomes = append(report.Outcomes, outcomes...)
+	c.setReport(report)
+	for _, o := range outcomes {
+		if o.Err != nil {
+			gologger.Warning().Msgf("%s search %s: %s\n", o.Provider, o.Status, o.Err)
+		}
+	}
+	if emitErr != nil {
+		return emitErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if report.Failed() {
+		return report.Err()
+	}
 	return nil
 }
 
-// check if the session is validated or not
-func (c *CyberRetrieveEngine) checkSession() error {
-	var (
-		err       error = nil
-		engineNum int   = 0
-	)
-	if c.searchMode&ModeQuake == ModeQuake {
-		provider := &quake.Provider{}
-		gologger.Info().Msgf("Check %s authorization,wait a second...\n", provider.Name())
-		if ok := provider.Auth(c.sessions); !ok {
-			errorMsg := fmt.Sprintf("%s auth err, please check your quake token", provider.Name())
-			err = errors.New(errorMsg)
-		} else {
-			c.providers = append(c.providers, provider)
-			engineNum++
+// enabledProviders creates the registered providers of the enabled names, without authorization
+func (c *CyberRetrieveEngine) enabledProviders() ([]sources.Provider, error) {
+	providers := make([]sources.Provider, 0, len(c.providerNames))
+	for _, name := range c.providerNames {
+		info, ok := sources.LookupProvider(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown provider %s, available: %s", name, strings.Join(sources.Providers(), ", "))
 		}
+		provider := info.New()
+		if options, ok := c.providerOptions[strings.ToUpper(info.Name)]; ok {
+			configurable, ok := provider.(sources.Configurable)
+			if !ok {
+				return nil, fmt.Errorf("provider %s has no options", info.Name)
+			}
+			if err := configurable.Configure(options); err != nil {
+				return nil, fmt.Errorf("provider %s options: %w", info.Name, err)
+			}
+		}
+		providers = append(providers, provider)
 	}
-	if c.searchMode&ModeFofa == ModeFofa {
-		provider := &fofa.Provider{}
-		gologger.Info().Msgf("Check %s authorization,wait a second...\n", provider.Name())
-		if ok := provider.Auth(c.sessions); !ok {
-			errorMsg := fmt.Sprintf("%s auth err, please check your quake token", provider.Name())
-			err = errors.New(errorMsg)
-		} else {
-			c.providers = append(c.providers, provider)
-			engineNum++
+	return providers, nil
+}
+
+// providerQuery returns a copy of the base query for the provider, with the plan warnings.
+// If autoGrammar is on, or several engines are used, and corresponding engine's query is empty,
+// then transfer the default query into the corresponding format.
+// If deep search is on, the query is widened by the expanders, the remote ones only when resolve is set
+func (c *CyberRetrieveEngine) providerQuery(ctx context.Context, base *sources.Query, provider sources.Provider, multiEngine, resolve bool) (*sources.Query, []string, error) {
+	query := *base
+	native := query.Native(provider.Name())
+	if c.isDeepSearch {
+		// when use deep search mode, unlimited query number
+		query.NumberOfQuery = -1
+	}
+	grammar := provider.Grammar()
+	if grammar == nil {
+		// the provider can't translate queries
+		return &query, nil, nil
+	}
+
+	if native != "" {
+		if !c.isDeepSearch {
+			return &query, nil, nil
 		}
+		node, err := grammar.Parse(native)
+		if err != nil {
+			warning := fmt.Sprintf("the %s query is not widened, it can't be parsed: %s", provider.Name(), err)
+			return &query, []string{warning}, nil
+		}
+		node, deferred, err := c.expand(ctx, node, grammar, resolve)
+		if err != nil {
+			return nil, nil, err
+		}
+		if deferred.unrendered {
+			query.SetNative(provider.Name(), node.String())
+			return &query, deferred.warnings, nil
+		}
+		if native, err = grammar.Render(node); err != nil {
+			return nil, nil, err
+		}
+		query.SetNative(provider.Name(), native)
+		return &query, deferred.warnings, nil
+	}
+
+	if !(c.isAutoGrammar || multiEngine || c.isDeepSearch) {
+		return &query, nil, nil
 	}
-	if c.searchMode&ModeHunter == ModeHunter {
-		provider := &hunter.Provider{}
-		gologger.Info().Msgf("Check %s authorization,wait a second...\n", provider.Name())
-		if ok := provider.Auth(c.sessions); !ok {
-			errorMsg := fmt.Sprintf("%s auth err, please check your quake token", provider.Name())
-			err = errors.New(errorMsg)
+	node, err := neutralQuery(&query)
+	if err != nil {
+		return nil, nil, err
+	}
+	deferred := &deferredTerms{}
+	if c.isDeepSearch {
+		if node, deferred, err = c.expand(ctx, node, grammar, resolve); err != nil {
+			return nil, nil, err
+		}
+	}
+	if deferred.unrendered {
+		query.SetNative(provider.Name(), node.String())
+		return &query, deferred.warnings, nil
+	}
+	prdGrammar, err := c.autoGrammar(node, provider)
+	if err != nil {
+		return nil, deferred.warnings, err
+	}
+	query.SetNative(provider.Name(), prdGrammar)
+	return &query, deferred.warnings, nil
+}
+
+// expand widens the query AST for the grammar with the deep search expanders.
+// Unless resolve is set, the terms of the remote expanders are kept as they are and returned as deferred
+func (c *CyberRetrieveEngine) expand(ctx context.Context, node sources.Node, grammar *sources.Grammar, resolve bool) (sources.Node, *deferredTerms, error) {
+	deferred := &deferredTerms{}
+	expanders := make([]sources.Expander, 0, len(c.expanders))
+	for _, name := range c.expanders {
+		e, ok := sources.LookupExpander(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown expander %s, available: %s", name, strings.Join(sources.Expanders(), ", "))
+		}
+		if remote, ok := e.(sources.RemoteExpander); ok && !resolve {
+			e = &deferredExpander{RemoteExpander: remote, deferred: deferred}
+		}
+		expanders = append(expanders, e)
+	}
+	node, err := sources.Expand(ctx, node, grammar, expanders...)
+	return node, deferred, err
+}
+
+// deferredTerms is the terms of the remote expanders kept as they are in a plan
+type deferredTerms struct {
+	warnings   []string
+	unrendered bool // some term can't be rendered for the provider before it's resolved
+}
+
+// deferredExpander keeps the terms its remote expander would call the remote service for,
+// so a plan makes no remote call
+type deferredExpander struct {
+	sources.RemoteExpander
+	deferred *deferredTerms
+}
+
+func (e *deferredExpander) Expand(ctx context.Context, t *sources.TermNode, g *sources.Grammar) (sources.Node, error) {
+	if !e.Remote(t) {
+		return e.RemoteExpander.Expand(ctx, t, g)
+	}
+	warning := fmt.Sprintf("%s will be resolved by the %s expander at search time", t, e.Name())
+	if _, err := g.Render(t); err != nil {
+		e.deferred.unrendered = true
+		warning += ", the query is shown in the neutral syntax until then"
+	}
+	if !slices.Contains(e.deferred.warnings, warning) {
+		e.deferred.warnings = append(e.deferred.warnings, warning)
+	}
+	return nil, nil
+}
+
+// check if the session is validated or not,
+// the validated providers having a query in any plan are returned for searching,
+// the others are returned as failed outcomes.
+// The session of a provider is checked once per engine
+func (c *CyberRetrieveEngine) checkSession(ctx context.Context, plans ...*Plan) ([]sources.Provider, []Outcome, error) {
+	var (
+		err          error = nil
+		engineNum    int   = 0
+		checked      bool
+		providers    []sources.Provider
+		authFailures []Outcome
+	)
+	for _, provider := range c.providers {
+		if !hasQuery(plans, provider.Name()) {
+			continue
+		}
+		ok, checkedNow, authErr := c.auth(ctx, provider)
+		checked = checked || checkedNow
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if !ok {
+			err = authErr
+			if err == nil {
+				errorMsg := fmt.Sprintf("please check your %s key", provider.Name())
+				err = sources.NewProviderError(provider.Name(), sources.ErrAuthFailed, errorMsg, nil)
+			}
+			authFailures = append(authFailures, newOutcome(provider.Name(), 0, 0, err))
 		} else {
-			c.providers = append(c.providers, provider)
+			providers = append(providers, provider)
 			engineNum++
 		}
 	}
-	if engineNum == 0 {
+	if engineNum == 0 && err == nil {
 		err = errors.New("please choose a search engine")
-	} else if engineNum > 1 {
-		c.isAutoGrammar = true
 	}
 
-	gologger.Info().Msgf("All search engine authorization check done...\n")
+	if checked {
+		gologger.Info().Msgf("All search engine authorization check done...\n")
+	}
 
 	// If have at least one engine can be used, just warning the unauthed engine and return nil
 	if engineNum != 0 && err != nil {
-		gologger.Warning().Msgf("%s\n", err)
-		return nil
+		if checked {
+			gologger.Warning().Msgf("%s\n", err)
+		}
+		return providers, authFailures, nil
 	} else {
-		return err
+		return providers, authFailures, err
 	}
 }
 
-func (c *CyberRetrieveEngine) autoGrammar(query, name string) string {
-	// Todo When you add new search engine, add case condition here
-	switch name {
-	case quake.QUAKE:
-		result, err := quake.ToQuakeGrammar(query)
-		if err != nil {
-			gologger.Error().Msg(err.Error())
-		}
-		return result
-	case fofa.FOFA:
-		result, err := fofa.ToFofaGrammar(query)
-		if err != nil {
-			gologger.Error().Msgf(err.Error())
+// auth checks the session of the provider once per engine, the answer is kept for the next searches.
+// A check which failed with an error, or was interrupted by the context, is done again next time
+func (c *CyberRetrieveEngine) auth(ctx context.Context, provider sources.Provider) (ok, checked bool, err error) {
+	state := c.auths[provider.Name()]
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if state.checked {
+		return state.ok, false, nil
+	}
+
+	gologger.Info().Msgf("Check %s authorization,wait a second...\n", provider.Name())
+	ok, err = provider.Auth(ctx, c.sessions)
+	if err != nil {
+		return false, true, err
+	}
+	state.ok = ok
+	state.checked = ctx.Err() == nil
+	return state.ok, true, nil
+}
+
+// hasQuery reports whether the provider has a query to search in any plan
+func hasQuery(plans []*Plan, name string) bool {
+	for _, plan := range plans {
+		if _, ok := plan.queries()[name]; ok {
+			return true
 		}
-		return result
-	case hunter.HUNTER:
-		result, err := hunter.ToHunterGrammer(query)
-		if err != nil {
-			gologger.Error().Msgf(err.Error())
+	}
+	return false
+}
+
+// autoGrammar translates the neutral query into the grammar of the provider,
+// every field and operator the provider can't express is reported
+func (c *CyberRetrieveEngine) autoGrammar(node sources.Node, provider sources.Provider) (string, error) {
+	grammar := provider.Grammar()
+	if errs := grammar.Check(node); len(errs) != 0 {
+		return "", errors.Join(errs...)
+	}
+	return grammar.Render(node)
+}
+
+// neutralQuery returns the AST of the neutral query. When it's empty, the first
+// provider specific query is parsed back, so it can be re-targeted at the other providers
+func neutralQuery(query *sources.Query) (sources.Node, error) {
+	if query.Query != "" {
+		return sources.ParseQuery(query.Query)
+	}
+	for _, name := range sources.Providers() {
+		if native := query.Native(name); native != "" {
+			if grammar := sources.LookupGrammar(name); grammar != nil {
+				return grammar.Parse(native)
+			}
 		}
-		return result
-	default:
-		return ""
 	}
+	return nil, errors.New("query is empty")
 }
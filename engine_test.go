@@ -0,0 +1,197 @@
+package cyberetrieve
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+// flakyProvider fails the authorization with an error a number of times, then accepts the key
+type flakyProvider struct {
+	name     string
+	failures int32
+	calls    atomic.Int32
+	reject   bool
+}
+
+func (p *flakyProvider) Name() string                   { return p.name }
+func (p *flakyProvider) Grammar() *sources.Grammar      { return nil }
+func (p *flakyProvider) PageSize(numberOfQuery int) int { return numberOfQuery }
+
+func (p *flakyProvider) Auth(context.Context, *sources.Session) (bool, error) {
+	if p.calls.Add(1) <= p.failures {
+		return false, sources.ResponseError(p.name, 502, "")
+	}
+	return !p.reject, nil
+}
+
+func (p *flakyProvider) Search(context.Context, *sources.Query) (*sources.Stream, error) {
+	stream := sources.NewStream()
+	go func() {
+		stream.Results <- &sources.Result{IP: "1.1.1.1", Port: 80}
+		stream.Close(nil)
+	}()
+	return stream, nil
+}
+
+func TestAuthRetriedAfterError(t *testing.T) {
+	provider := &flakyProvider{name: "FLAKY", failures: 1}
+	sources.RegisterProvider(sources.ProviderInfo{Name: provider.name, New: func() sources.Provider { return provider }})
+	engine := NewEngine(sources.Session{}, WithProvider(provider.name))
+	query := sources.Query{Query: `ip:"1.1.1.1"`, NumberOfQuery: 10}
+
+	run, err := engine.Search(context.Background(), query)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	err = run.Wait()
+	if !errors.Is(err, sources.ErrUpstream) || errors.Is(err, sources.ErrAuthFailed) {
+		t.Fatalf("first Search() error = %v, want an upstream error", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		run, err = engine.Search(context.Background(), query)
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		found := 0
+		for range run.Results {
+			found++
+		}
+		if err = run.Wait(); err != nil || found != 1 {
+			t.Fatalf("Search() #%d = %d results, %v, want 1 result", i, found, err)
+		}
+	}
+	if calls := provider.calls.Load(); calls != 2 {
+		t.Errorf("Auth called %d times, want 2", calls)
+	}
+}
+
+func TestAuthRejectionCached(t *testing.T) {
+	provider := &flakyProvider{name: "REJECTING", reject: true}
+	sources.RegisterProvider(sources.ProviderInfo{Name: provider.name, New: func() sources.Provider { return provider }})
+	engine := NewEngine(sources.Session{}, WithProvider(provider.name))
+	query := sources.Query{Query: `ip:"1.1.1.1"`, NumberOfQuery: 10}
+
+	for i := 0; i < 2; i++ {
+		run, err := engine.Search(context.Background(), query)
+		if err != nil {
+			t.Fatalf("Search() error = %v", err)
+		}
+		if err = run.Wait(); !errors.Is(err, sources.ErrAuthFailed) {
+			t.Fatalf("Search() #%d error = %v, want an auth failure", i, err)
+		}
+	}
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Errorf("Auth called %d times, want 1", calls)
+	}
+}
+
+// streamProvider sends count distinct results until the context is done
+type streamProvider struct {
+	name  string
+	count int
+}
+
+func (p *streamProvider) Name() string                   { return p.name }
+func (p *streamProvider) Grammar() *sources.Grammar      { return nil }
+func (p *streamProvider) PageSize(numberOfQuery int) int { return numberOfQuery }
+
+func (p *streamProvider) Auth(context.Context, *sources.Session) (bool, error) {
+	return true, nil
+}
+
+func (p *streamProvider) Search(ctx context.Context, _ *sources.Query) (*sources.Stream, error) {
+	stream := sources.NewStream()
+	go func() {
+		var err error
+		defer func() { stream.Close(err) }()
+		for i := 0; i < p.count; i++ {
+			select {
+			case stream.Results <- &sources.Result{IP: p.name, Port: i + 1}:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+		}
+	}()
+	return stream, nil
+}
+
+func TestConcurrentSearchNotStalledByUnreadRun(t *testing.T) {
+	names := []string{"STREAM1", "STREAM2", "STREAM3"}
+	for _, name := range names {
+		provider := &streamProvider{name: name, count: 5000}
+		sources.RegisterProvider(sources.ProviderInfo{Name: name, New: func() sources.Provider { return provider }})
+	}
+	engine := NewEngine(sources.Session{}, WithProvider(names...))
+	query := sources.Query{Query: `ip:"1.1.1.1"`, NumberOfQuery: -1}
+
+	// the results of the first run are never read
+	ctx, cancel := context.WithCancel(context.Background())
+	unread, err := engine.Search(ctx, query)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	defer func() {
+		cancel()
+		unread.Wait()
+	}()
+	// wait for every search of the first run to hold its slot
+	for started := 0; started < len(names); {
+		if event := <-unread.Events; event.Kind == EventSearchStart {
+			started++
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan int)
+	go func() {
+		run, err := engine.Search(context.Background(), query)
+		if err != nil {
+			t.Errorf("Search() error = %v", err)
+			close(done)
+			return
+		}
+		found := 0
+		for range run.Results {
+			found++
+		}
+		run.Wait()
+		done <- found
+	}()
+
+	select {
+	case found := <-done:
+		if want := 3 * 5000; found != want {
+			t.Errorf("drained Search() = %d results, want %d", found, want)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("drained Search() is stalled by the unread one")
+	}
+}
+
+func TestHandlerErrorReportedAsCause(t *testing.T) {
+	provider := &streamProvider{name: "STREAM_HANDLER", count: 1000}
+	sources.RegisterProvider(sources.ProviderInfo{Name: provider.name, New: func() sources.Provider { return provider }})
+	// the results buffer is smaller than the results, so the search is still running when the handler fails
+	query := sources.Query{Query: `ip:"1.1.1.1"`, NumberOfQuery: 10}
+	engine := NewCyberRetrieveEngine(query, sources.Session{}, WithProvider(provider.name))
+
+	errFull := errors.New("disk full")
+	err := engine.RetrieveWithHandler(func(sources.Result) error { return errFull })
+	if err != errFull {
+		t.Fatalf("RetrieveWithHandler() error = %v, want %v", err, errFull)
+	}
+	outcomes := engine.Report().Outcomes
+	if len(outcomes) != 1 {
+		t.Fatalf("%d outcomes, want 1", len(outcomes))
+	}
+	if o := outcomes[0]; !errors.Is(o.Err, errFull) || errors.Is(o.Err, context.Canceled) {
+		t.Errorf("outcome error = %v, want the handler error as the cause", o.Err)
+	}
+}
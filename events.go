@@ -0,0 +1,65 @@
+package cyberetrieve
+
+import "sync"
+
+// EVENT_BUFFER is the size of the events buffer of RetrieveStream
+const EVENT_BUFFER = 64
+
+// EventKind is the kind of a search event
+type EventKind uint8
+
+const (
+	// EventSearchStart a provider starts searching a query
+	EventSearchStart EventKind = iota
+	// EventSearchEnd a provider search ended, or failed the authorization, see Outcome
+	EventSearchEnd
+	// EventDone the whole search ended, see Report and Err
+	EventDone
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventSearchStart:
+		return "search start"
+	case EventSearchEnd:
+		return "search end"
+	case EventDone:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
+// Event tells the progress of a running search
+type Event struct {
+	Kind       EventKind
+	Provider   string   // provider of EventSearchStart and EventSearchEnd
+	QueryIndex int      // index of the query in the batch
+	Outcome    *Outcome // how the provider search ended, for EventSearchEnd
+	Report     *Report  // report of the whole search, for EventDone
+	Err        error    // error of the whole search, for EventDone
+}
+
+// eventMu makes checking the free slots of an events buffer and sending one event atomic
+var eventMu sync.Mutex
+
+// sendEvent sends the event without blocking the search, the event is dropped
+// when the events buffer is full. The last slot of the buffer is kept for EventDone,
+// which is sent once every other sender is done
+func sendEvent(events chan Event, event Event) {
+	if events == nil {
+		return
+	}
+	if event.Kind == EventDone {
+		events <- event
+		return
+	}
+
+	// the senders are concurrent, without the lock two of them could take the last slot
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	if len(events) >= cap(events)-1 {
+		return
+	}
+	events <- event
+}
@@ -0,0 +1,39 @@
+package cyberetrieve
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendEventKeepsSlotForDone(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		events := make(chan Event, 2)
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for j := 0; j < 8; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				sendEvent(events, Event{Kind: EventSearchStart})
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		done := make(chan struct{})
+		go func() {
+			sendEvent(events, Event{Kind: EventDone})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("EventDone is blocked, the last slot was taken")
+		}
+		if len(events) != cap(events) {
+			t.Fatalf("%d events buffered, want %d", len(events), cap(events))
+		}
+	}
+}
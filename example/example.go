@@ -8,13 +8,10 @@ import (
 )
 
 func main() {
-	// Query struct for the search
-	query := sources.Query{
-		Query: `title:"login"`,
-		//FofaQuery: "xxx" // specific query for fofa
-		//QuakeQuery: "xxxx" //specific query for quake
-		NumberOfQuery: 5, // number of query in each engine
-	}
+	// Query struct for the search, built from title:"login"
+	query := sources.Title("login").Query(5) // number of query in each engine
+	//query.FofaQuery = "xxx" // specific query for fofa
+	//query.QuakeQuery = "xxxx" //specific query for quake
 	session := sources.Session{
 		QuakeToken: "xxx-xxx-xxx", // quake token
 		FofaKey:    "xxx-xxx-xxx", // fofa key
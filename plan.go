@@ -0,0 +1,160 @@
+package cyberetrieve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+// Plan is what a search would send to each provider, it's made without calling any provider API
+type Plan struct {
+	Providers []*ProviderPlan
+}
+
+// ProviderPlan is the planned search of a provider
+type ProviderPlan struct {
+	Name          string
+	Query         string // the final query sent to the provider
+	NumberOfQuery int    // -1 means unlimited
+	PageSize      int
+	Pages         int      // expected number of pages, -1 when pages are fetched until no result left
+	Skipped       bool     // the provider is left out by the translate policy
+	Err           error    // why the query can't be translated for the provider
+	Warnings      []string // translation and paging warnings
+
+	provider sources.Provider
+	query    *sources.Query
+}
+
+// Plan resolves the enabled providers and the final query, page size and pages of each of them,
+// without checking sessions or calling any provider API.
+// The terms of the remote expanders, e.g. a favicon url, are resolved at search time, a warning tells them.
+// The plan is returned with the error the search would fail with
+func (c *CyberRetrieveEngine) Plan() (*Plan, error) {
+	return c.PlanContext(context.Background())
+}
+
+// PlanContext is Plan with a context
+func (c *CyberRetrieveEngine) PlanContext(ctx context.Context) (*Plan, error) {
+	if c.Query == nil {
+		return nil, errors.New("the engine has no query, use PlanQuery")
+	}
+	return c.plan(ctx, c.Query, false)
+}
+
+// PlanQuery is Plan for the query, it's used with an engine created by NewEngine
+func (c *CyberRetrieveEngine) PlanQuery(ctx context.Context, query sources.Query) (*Plan, error) {
+	return c.plan(ctx, &query, false)
+}
+
+// plan makes the search plan of the query, the remote expanders are only called to resolve a search
+func (c *CyberRetrieveEngine) plan(ctx context.Context, query *sources.Query, resolve bool) (*Plan, error) {
+	if c.providerErr != nil {
+		return nil, c.providerErr
+	}
+	providers := c.providers
+	if len(providers) == 0 {
+		return nil, errors.New("please choose a search engine")
+	}
+
+	plan := &Plan{Providers: make([]*ProviderPlan, 0, len(providers))}
+	for _, provider := range providers {
+		plan.Providers = append(plan.Providers, c.planProvider(ctx, query, provider, len(providers) > 1, resolve))
+	}
+	return plan, plan.err()
+}
+
+func (c *CyberRetrieveEngine) planProvider(ctx context.Context, base *sources.Query, provider sources.Provider, multiEngine, resolve bool) *ProviderPlan {
+	pp := &ProviderPlan{
+		Name:     provider.Name(),
+		provider: provider,
+	}
+
+	query, warnings, err := c.providerQuery(ctx, base, provider, multiEngine, resolve)
+	pp.Warnings = append(pp.Warnings, warnings...)
+	if err != nil {
+		pp.Err = err
+		if c.translatePolicy == TranslateSkip && errors.Is(err, sources.ErrUntranslatable) {
+			pp.Skipped = true
+			pp.Warnings = append(pp.Warnings, fmt.Sprintf("skipped: %s", err))
+		}
+		return pp
+	}
+
+	pp.query = query
+	pp.Query = query.Query
+	if native := query.Native(provider.Name()); native != "" {
+		pp.Query = native
+	} else {
+		pp.Warnings = append(pp.Warnings, "the query is sent without translation, use WithAutoGrammar to translate it")
+	}
+
+	pp.NumberOfQuery = query.NumberOfQuery
+	pp.PageSize = provider.PageSize(query.NumberOfQuery)
+	switch {
+	case query.NumberOfQuery == -1:
+		pp.Pages = -1
+	case pp.PageSize > 0:
+		pp.Pages = (query.NumberOfQuery + pp.PageSize - 1) / pp.PageSize
+	}
+	if query.NumberOfQuery != -1 && pp.PageSize > query.NumberOfQuery {
+		pp.Warnings = append(pp.Warnings,
+			fmt.Sprintf("%d results are fetched at least, more than the %d asked", pp.PageSize, query.NumberOfQuery))
+	}
+	return pp
+}
+
+// err returns the error the search fails with, or nil when at least one provider can search
+func (p *Plan) err() error {
+	var errs []error
+	for _, pp := range p.Providers {
+		if pp.Err != nil && !pp.Skipped {
+			errs = append(errs, pp.Err)
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+	if len(p.queries()) == 0 {
+		return errors.New("no search engine can translate the query")
+	}
+	return nil
+}
+
+// queries returns the query of each provider which can search
+func (p *Plan) queries() map[string]*sources.Query {
+	queries := make(map[string]*sources.Query, len(p.Providers))
+	for _, pp := range p.Providers {
+		if pp.query != nil {
+			queries[pp.Name] = pp.query
+		}
+	}
+	return queries
+}
+
+// String returns the plan in human readable lines
+func (p *Plan) String() string {
+	var sb strings.Builder
+	for _, pp := range p.Providers {
+		switch {
+		case pp.Skipped:
+			fmt.Fprintf(&sb, "%s: skipped\n", pp.Name)
+		case pp.Err != nil:
+			fmt.Fprintf(&sb, "%s: %s\n", pp.Name, pp.Err)
+		default:
+			pages := "until no result left"
+			if pp.Pages != -1 {
+				pages = fmt.Sprintf("%d pages", pp.Pages)
+			}
+			fmt.Fprintf(&sb, "%s: %s\n", pp.Name, pp.Query)
+			fmt.Fprintf(&sb, "    page size %d, %s\n", pp.PageSize, pages)
+		}
+		for _, warning := range pp.Warnings {
+			fmt.Fprintf(&sb, "    warning: %s\n", warning)
+		}
+	}
+	return sb.String()
+}
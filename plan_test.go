@@ -0,0 +1,46 @@
+package cyberetrieve
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+	"github.com/N0el4kLs/cyberetrieve/sources/fofa"
+)
+
+func TestPlanDefersFavicon(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	engine := NewEngine(sources.Session{}, WithProvider(fofa.FOFA), WithDeepSearch("favicon"))
+	value := server.URL + "/favicon.ico"
+	plan, err := engine.PlanQuery(context.Background(), sources.Query{Query: `favicon:"` + value + `"`, NumberOfQuery: 10})
+	if err != nil {
+		t.Fatalf("PlanQuery() error = %v", err)
+	}
+	if n := hits.Load(); n != 0 {
+		t.Fatalf("PlanQuery() downloaded the favicon %d times", n)
+	}
+	if len(plan.Providers) != 1 {
+		t.Fatalf("PlanQuery() providers = %d, want 1", len(plan.Providers))
+	}
+	pp := plan.Providers[0]
+	if !strings.Contains(pp.Query, value) {
+		t.Errorf("planned query = %s, want the favicon url kept", pp.Query)
+	}
+	found := false
+	for _, warning := range pp.Warnings {
+		found = found || strings.Contains(warning, "resolved by the favicon expander at search time")
+	}
+	if !found {
+		t.Errorf("plan warnings = %q, want the favicon deferred", pp.Warnings)
+	}
+}
@@ -0,0 +1,108 @@
+package cyberetrieve
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Status is how the search of a provider ended
+type Status uint8
+
+const (
+	// StatusCompleted the search fetched the results asked, or all the results there are
+	StatusCompleted Status = iota
+	// StatusTruncated the search was stopped by an error after some results were fetched
+	StatusTruncated
+	// StatusFailed the search was stopped by an error before any result was fetched
+	StatusFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusCompleted:
+		return "completed"
+	case StatusTruncated:
+		return "truncated"
+	case StatusFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("status(%d)", uint8(s))
+	}
+}
+
+// Outcome is how the search of a query by a provider ended
+type Outcome struct {
+	Provider   string
+	QueryIndex int // index of the query in the batch
+	Status     Status
+	Found      int   // number of results received from the provider, duplicates included
+	Err        error // why the search stopped, nil when it completed. See the sources.Err* kinds
+
+	// Warnings is the warnings of the provider, e.g. a query syntax prompt
+	Warnings []string
+}
+
+// newOutcome returns the outcome of a search which found results and stopped with err
+func newOutcome(provider string, queryIndex, found int, err error) Outcome {
+	status := StatusCompleted
+	switch {
+	case err != nil && found > 0:
+		status = StatusTruncated
+	case err != nil:
+		status = StatusFailed
+	}
+	return Outcome{Provider: provider, QueryIndex: queryIndex, Status: status, Found: found, Err: err}
+}
+
+// Report is the outcome of every provider search of a retrieve,
+// providers failing the authorization are reported as failed
+type Report struct {
+	Outcomes []Outcome
+}
+
+// Failed reports whether no search completed or fetched any result
+func (r *Report) Failed() bool {
+	for _, o := range r.Outcomes {
+		if o.Status != StatusFailed {
+			return false
+		}
+	}
+	return len(r.Outcomes) != 0
+}
+
+// Err returns the errors of the searches which didn't complete, or nil
+func (r *Report) Err() error {
+	var errs []error
+	for _, o := range r.Outcomes {
+		if o.Err != nil {
+			errs = append(errs, o.Err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// String returns the report in human readable lines
+func (r *Report) String() string {
+	batch := false
+	for _, o := range r.Outcomes {
+		batch = batch || o.QueryIndex != 0
+	}
+
+	var sb strings.Builder
+	for _, o := range r.Outcomes {
+		fmt.Fprintf(&sb, "%s", o.Provider)
+		if batch {
+			fmt.Fprintf(&sb, " query #%d", o.QueryIndex)
+		}
+		fmt.Fprintf(&sb, ": %s, %d items", o.Status, o.Found)
+		if o.Err != nil {
+			fmt.Fprintf(&sb, ", %s", o.Err)
+		}
+		for _, warning := range o.Warnings {
+			fmt.Fprintf(&sb, ", warning: %s", warning)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -0,0 +1,55 @@
+package cyberetrieve
+
+import (
+	"context"
+	"sync"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+// Run is a search started by Search, with its own results and deduplication
+type Run struct {
+	// Results receives the unique results as they are fetched, it's closed when the search ends
+	Results <-chan sources.Result
+
+	// Events tells the progress of the search, it's closed after Results, see RetrieveStream
+	Events <-chan Event
+
+	done   <-chan error
+	once   sync.Once
+	err    error
+	report *Report
+}
+
+// Wait waits for the search to end and returns its error,
+// Results must be drained or the context of the search cancelled
+func (r *Run) Wait() error {
+	r.once.Do(func() {
+		r.err = <-r.done
+	})
+	return r.err
+}
+
+// Report waits for the search to end and returns how the search of each provider ended
+func (r *Run) Report() *Report {
+	r.Wait()
+	return r.report
+}
+
+// Search searches the query in the background and returns once it's planned,
+// it can be called many times, concurrently, each search has its own results and deduplication.
+// The sessions are checked on the first search needing them
+func (c *CyberRetrieveEngine) Search(ctx context.Context, query sources.Query) (*Run, error) {
+	return c.search(ctx, &query)
+}
+
+// search starts the search of the query with a result channel and events
+func (c *CyberRetrieveEngine) search(ctx context.Context, query *sources.Query) (*Run, error) {
+	numberOfQuery := 0
+	if query != nil {
+		numberOfQuery = query.NumberOfQuery
+	}
+	results := make(chan sources.Result, bufferSize(numberOfQuery))
+	events := make(chan Event, EVENT_BUFFER)
+	return c.start(ctx, query, &channelSink{ctx: ctx, results: results}, events)
+}
@@ -0,0 +1,64 @@
+package cyberetrieve
+
+import (
+	"context"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+// ResultSink receives the unique results of a search, e.g. to write them into a file or a database
+type ResultSink interface {
+	// Put receives a result, the search waits for it to return.
+	// An error aborts the search and is returned by the retrieve method,
+	// the searches it stops report it as their error in the Report
+	Put(result sources.Result) error
+}
+
+// ResultHandler is a function used as a ResultSink
+type ResultHandler func(result sources.Result) error
+
+// Put calls the handler with the result
+func (h ResultHandler) Put(result sources.Result) error {
+	return h(result)
+}
+
+// channelSink sends the results to a channel until ctx is done
+type channelSink struct {
+	ctx     context.Context
+	results chan sources.Result
+}
+
+func (s *channelSink) Put(result sources.Result) error {
+	select {
+	case s.results <- result:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// sliceSink appends the results to a slice
+type sliceSink struct {
+	results []sources.Result
+}
+
+func (s *sliceSink) Put(result sources.Result) error {
+	s.results = append(s.results, result)
+	return nil
+}
+
+// RetrieveWithHandler searches and calls the handler with each unique result as it's fetched,
+// the search waits for the handler, and stops with the error the handler returns
+func (c *CyberRetrieveEngine) RetrieveWithHandler(handler func(result sources.Result) error) error {
+	return c.RetrieveWithSink(context.Background(), ResultHandler(handler))
+}
+
+// RetrieveWithSink searches and puts each unique result into the sink as it's fetched,
+// the search waits for the sink, and stops with the error the sink returns or once ctx is done
+func (c *CyberRetrieveEngine) RetrieveWithSink(ctx context.Context, sink ResultSink) error {
+	run, err := c.start(ctx, c.Query, sink, nil)
+	if err != nil {
+		return err
+	}
+	return run.Wait()
+}
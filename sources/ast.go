@@ -0,0 +1,103 @@
+package sources
+
+import (
+	"strings"
+)
+
+// Operator is a boolean operator of the query AST,
+// operators can be combined as a set, e.g. OpAnd | OpOr
+type Operator uint8
+
+const (
+	OpAnd Operator = 1 << iota
+	OpOr
+	OpNot
+)
+
+// String returns the neutral grammar symbol of the operator
+func (o Operator) String() string {
+	switch o {
+	case OpAnd:
+		return "&&"
+	case OpOr:
+		return "||"
+	case OpNot:
+		return "not"
+	default:
+		return "?"
+	}
+}
+
+// Node is a node of the neutral query AST
+type Node interface {
+	// String returns the node in neutral query grammar
+	String() string
+
+	node()
+}
+
+// TermNode is a single field search, e.g. title:"login"
+type TermNode struct {
+	Field string // neutral field name, e.g. title
+	Value string // unquoted and unescaped search value
+}
+
+// NotNode negates the wrapped expression
+type NotNode struct {
+	Expr Node
+}
+
+// BinaryNode joins two expressions with AND or OR
+type BinaryNode struct {
+	Op    Operator
+	Left  Node
+	Right Node
+}
+
+func (*TermNode) node()   {}
+func (*NotNode) node()    {}
+func (*BinaryNode) node() {}
+
+func (t *TermNode) String() string {
+	return t.Field + ":" + Quote(t.Value)
+}
+
+func (n *NotNode) String() string {
+	if _, ok := n.Expr.(*BinaryNode); ok {
+		return "not (" + n.Expr.String() + ")"
+	}
+	return "not " + n.Expr.String()
+}
+
+func (b *BinaryNode) String() string {
+	return wrapChild(b.Op, b.Left) + " " + b.Op.String() + " " + wrapChild(b.Op, b.Right)
+}
+
+// wrapChild adds parentheses around child when its operator binds looser than op
+func wrapChild(op Operator, child Node) string {
+	if b, ok := child.(*BinaryNode); ok && b.Op != op && op == OpAnd {
+		return "(" + b.String() + ")"
+	}
+	return child.String()
+}
+
+// Quote wraps the value in double quotes, escaping backslashes and double quotes
+func Quote(value string) string {
+	return `"` + Escape(value) + `"`
+}
+
+// Escape escapes backslashes and double quotes in value,
+// so it can be placed between double quotes
+func Escape(value string) string {
+	if !strings.ContainsAny(value, `"\`) {
+		return value
+	}
+	var sb strings.Builder
+	for _, r := range value {
+		if r == '"' || r == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
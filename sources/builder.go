@@ -0,0 +1,207 @@
+package sources
+
+import (
+	"strconv"
+)
+
+// Expr is a query expression made by the builder, it's the recommended way to construct a Query,
+// so values never have to be quoted or escaped by hand:
+//
+//	query := sources.Title("login").And(sources.Not(sources.Domain(""))).Query(100)
+type Expr struct {
+	node Node
+}
+
+// NewExpr wraps a query AST node into an expression
+func NewExpr(node Node) *Expr {
+	return &Expr{node: node}
+}
+
+// ParseExpr parses a neutral query into an expression
+func ParseExpr(query string) (*Expr, error) {
+	node, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return NewExpr(node), nil
+}
+
+// Term searches value in the neutral field
+func Term(field, value string) *Expr {
+	return NewExpr(&TermNode{Field: field, Value: value})
+}
+
+// IP searches an ip address
+func IP(ip string) *Expr {
+	return Term(FieldIP, ip)
+}
+
+// CIDR searches the ip addresses of a network, e.g. 1.1.1.0/24
+func CIDR(cidr string) *Expr {
+	return Term(FieldCIDR, cidr)
+}
+
+// Port searches a port
+func Port(port int) *Expr {
+	return Term(FieldPort, strconv.Itoa(port))
+}
+
+// Protocol searches the service protocol, e.g. ssh
+func Protocol(protocol string) *Expr {
+	return Term(FieldProtocol, protocol)
+}
+
+// Country searches a country by its code, english or chinese name, e.g. CN
+func Country(country string) *Expr {
+	return Term(FieldCountry, country)
+}
+
+// Region searches a province or state
+func Region(region string) *Expr {
+	return Term(FieldRegion, region)
+}
+
+// City searches a city
+func City(city string) *Expr {
+	return Term(FieldCity, city)
+}
+
+// ASN searches an autonomous system number
+func ASN(asn int) *Expr {
+	return Term(FieldASN, strconv.Itoa(asn))
+}
+
+// Org searches the organization owning the ip
+func Org(org string) *Expr {
+	return Term(FieldOrg, org)
+}
+
+// Domain searches a domain, Domain("") with Not searches assets which have a domain
+func Domain(domain string) *Expr {
+	return Term(FieldDomain, domain)
+}
+
+// Header searches the http response header
+func Header(header string) *Expr {
+	return Term(FieldHeader, header)
+}
+
+// Title searches the html title
+func Title(title string) *Expr {
+	return Term(FieldTitle, title)
+}
+
+// Body searches the http response body
+func Body(body string) *Expr {
+	return Term(FieldBody, body)
+}
+
+// Server searches the http server header
+func Server(server string) *Expr {
+	return Term(FieldServer, server)
+}
+
+// App searches a product or app fingerprint
+func App(app string) *Expr {
+	return Term(FieldApp, app)
+}
+
+// StatusCode searches the http status code
+func StatusCode(code int) *Expr {
+	return Term(FieldStatusCode, strconv.Itoa(code))
+}
+
+// Favicon searches the md5 hash of the favicon
+func Favicon(hash string) *Expr {
+	return Term(FieldFavicon, hash)
+}
+
+// IconHash searches the mmh3 hash of the favicon
+func IconHash(hash int) *Expr {
+	return Term(FieldIconHash, strconv.Itoa(hash))
+}
+
+// Cert searches the tls certificate
+func Cert(cert string) *Expr {
+	return Term(FieldCert, cert)
+}
+
+// ICP searches the ICP licence, e.g. 京ICP证030173号
+func ICP(licence string) *Expr {
+	return Term(FieldICP, licence)
+}
+
+// ICPUnit searches the ICP unit, e.g. 北京百度网讯科技有限公司
+func ICPUnit(unit string) *Expr {
+	return Term(FieldICPUnit, unit)
+}
+
+// Not negates the expression, an empty expression stays empty
+func Not(e *Expr) *Expr {
+	if e == nil || e.node == nil {
+		return NewExpr(nil)
+	}
+	return NewExpr(&NotNode{Expr: e.node})
+}
+
+// And joins the expressions, all of them have to match
+func And(exprs ...*Expr) *Expr {
+	return join(OpAnd, exprs)
+}
+
+// Or joins the expressions, one of them has to match
+func Or(exprs ...*Expr) *Expr {
+	return join(OpOr, exprs)
+}
+
+// And joins e with the other expressions, all of them have to match
+func (e *Expr) And(others ...*Expr) *Expr {
+	return join(OpAnd, append([]*Expr{e}, others...))
+}
+
+// Or joins e with the other expressions, one of them has to match
+func (e *Expr) Or(others ...*Expr) *Expr {
+	return join(OpOr, append([]*Expr{e}, others...))
+}
+
+// Node returns the query AST of the expression
+func (e *Expr) Node() Node {
+	return e.node
+}
+
+// String returns the expression in neutral query grammar, it can be parsed back by ParseExpr
+func (e *Expr) String() string {
+	if e.node == nil {
+		return ""
+	}
+	return e.node.String()
+}
+
+// Render renders the expression with the provider grammar
+func (e *Expr) Render(g *Grammar) (string, error) {
+	return g.Render(e.node)
+}
+
+// Query returns a Query searching the expression
+func (e *Expr) Query(numberOfQuery int) Query {
+	return Query{
+		Query:         e.String(),
+		NumberOfQuery: numberOfQuery,
+	}
+}
+
+// join chains the expressions with op from left to right, nil and empty expressions are ignored
+func join(op Operator, exprs []*Expr) *Expr {
+	var node Node
+	for _, e := range exprs {
+		if e == nil || e.node == nil {
+			continue
+		}
+		if node == nil {
+			node = e.node
+			continue
+		}
+		node = &BinaryNode{Op: op, Left: node, Right: e.node}
+	}
+	return NewExpr(node)
+}
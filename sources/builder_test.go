@@ -0,0 +1,70 @@
+package sources_test
+
+import (
+	"testing"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+	"github.com/N0el4kLs/cyberetrieve/sources/fofa"
+)
+
+func TestExprRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		expr *sources.Expr
+		want string
+	}{
+		{"term", sources.Title("login"), `title:"login"`},
+		{"escaped", sources.Title(`say "hi" \ bye`), `title:"say \"hi\" \\ bye"`},
+		{"keyword value", sources.Title("and"), `title:"and"`},
+		{"multibyte", sources.Org("北京百度网讯科技有限公司"), `org:"北京百度网讯科技有限公司"`},
+		{"numbers", sources.And(sources.Port(443), sources.ASN(4134), sources.StatusCode(200)), `port:"443" && asn:"4134" && status_code:"200"`},
+		{"not", sources.Title("login").And(sources.Not(sources.Domain(""))), `title:"login" && not domain:""`},
+		{"not group", sources.Not(sources.Or(sources.Port(80), sources.Port(443))), `not (port:"80" || port:"443")`},
+		{"precedence", sources.Or(sources.Title("a"), sources.And(sources.Port(80), sources.IP("1.1.1.1"))), `title:"a" || port:"80" && ip:"1.1.1.1"`},
+		{"group", sources.And(sources.Or(sources.Title("a"), sources.Port(80)), sources.IP("1.1.1.1")), `(title:"a" || port:"80") && ip:"1.1.1.1"`},
+		{"nil ignored", sources.And(nil, sources.Title("a"), nil), `title:"a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.expr.String()
+			if got != tt.want {
+				t.Fatalf("String() = %s, want %s", got, tt.want)
+			}
+			parsed, err := sources.ParseExpr(got)
+			if err != nil {
+				t.Fatalf("ParseExpr(%q) error = %v", got, err)
+			}
+			if parsed.String() != got {
+				t.Errorf("ParseExpr(%q) = %s, want the same expression", got, parsed)
+			}
+			want, err := tt.expr.Render(fofa.Grammar)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if rendered, _ := parsed.Render(fofa.Grammar); rendered != want {
+				t.Errorf("parsed Render() = %s, want %s", rendered, want)
+			}
+		})
+	}
+}
+
+func TestExprEmpty(t *testing.T) {
+	tests := []struct {
+		name string
+		expr *sources.Expr
+		want string
+	}{
+		{"and", sources.And(), ""},
+		{"not empty", sources.Not(sources.And()), ""},
+		{"not nil", sources.Not(nil), ""},
+		{"empty ignored", sources.And(sources.Or(), sources.Title("a"), sources.Not(sources.Or())), `title:"a"`},
+		{"method", sources.Title("a").Or(sources.And()), `title:"a"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.expr.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
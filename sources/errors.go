@@ -0,0 +1,131 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Kinds of provider errors, a ProviderError matches its kind with errors.Is
+var (
+	ErrAuthFailed     = errors.New("authentication failed")
+	ErrQuotaExhausted = errors.New("quota exhausted")
+	ErrRateLimited    = errors.New("rate limited")
+	ErrSyntax         = errors.New("query syntax error")
+	ErrUpstream       = errors.New("upstream error")
+	ErrDecode         = errors.New("decode failure")
+	ErrQuotaFloor     = errors.New("quota floor reached") // the search stopped to keep the configured quota floor
+)
+
+// ProviderError is an error of a provider API call
+type ProviderError struct {
+	Provider string
+	Kind     error  // one of the Err* kinds
+	Message  string // message returned by the provider API, if any
+	Err      error  // underlying error, if any
+}
+
+// NewProviderError returns a ProviderError of the kind
+func NewProviderError(provider string, kind error, message string, err error) *ProviderError {
+	return &ProviderError{Provider: provider, Kind: kind, Message: message, Err: err}
+}
+
+func (e *ProviderError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Provider, e.Kind)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is reports whether target is the kind of the error
+func (e *ProviderError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// RequestError wraps an error of sending a request to the provider API,
+// a context error is returned as it is
+func RequestError(provider string, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return NewProviderError(provider, ErrUpstream, "", err)
+}
+
+// DecodeError wraps an error of decoding a provider API response
+func DecodeError(provider string, err error) error {
+	return NewProviderError(provider, ErrDecode, "", err)
+}
+
+// ResponseError returns the error of a provider API response, the kind is guessed
+// from the message first, then from the status code, it's ErrUpstream by default
+func ResponseError(provider string, statusCode int, message string) error {
+	kind := messageKind(message)
+	if kind == nil {
+		kind = statusKind(statusCode)
+	}
+	if kind == nil {
+		kind = ErrUpstream
+	}
+	if message == "" && statusCode != 0 {
+		message = fmt.Sprintf("status code %d", statusCode)
+	}
+	return NewProviderError(provider, kind, message, nil)
+}
+
+// AuthError returns the error of an authorization response which can't tell whether the key is valid,
+// e.g. a rate limited or 5xx response, nil when the response is an answer about the key
+func AuthError(provider string, statusCode int, message string) error {
+	if statusCode == 429 || statusCode >= 500 {
+		return ResponseError(provider, statusCode, message)
+	}
+	return nil
+}
+
+// statusKind returns the error kind of an http status code, nil when it's not an error
+func statusKind(statusCode int) error {
+	switch {
+	case statusCode == 401 || statusCode == 403:
+		return ErrAuthFailed
+	case statusCode == 402:
+		return ErrQuotaExhausted
+	case statusCode == 429:
+		return ErrRateLimited
+	case statusCode >= 500:
+		return ErrUpstream
+	default:
+		return nil
+	}
+}
+
+// messageKeywords are the words of the provider API messages which tell the error kind
+var messageKeywords = []struct {
+	kind     error
+	keywords []string
+}{
+	{ErrQuotaExhausted, []string{"积分", "余额", "F点", "额度", "quota", "credit", "insufficient"}},
+	{ErrRateLimited, []string{"频繁", "请求太多", "稍后", "too many", "frequent", "rate limit"}},
+	{ErrSyntax, []string{"语法", "syntax"}},
+	{ErrAuthFailed, []string{"api-key", "令牌", "认证", "授权", "token", "unauthorized", "account invalid"}},
+}
+
+// messageKind returns the error kind told by a provider API message, or nil if unknown
+func messageKind(message string) error {
+	message = strings.ToLower(message)
+	for _, mk := range messageKeywords {
+		for _, keyword := range mk.keywords {
+			if strings.Contains(message, strings.ToLower(keyword)) {
+				return mk.kind
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package sources
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Expander widens a term of the query AST to find more related assets, it's used by deep search
+type Expander interface {
+	// Name returns the name the expander is enabled with, e.g. domain-cert
+	Name() string
+
+	// Expand returns the node replacing the term for the grammar, or nil to keep the term.
+	// Only fields supported by the grammar should be used in the returned node.
+	// An expander calling a remote service should stop once the context is done
+	Expand(ctx context.Context, t *TermNode, g *Grammar) (Node, error)
+}
+
+// RemoteExpander is an Expander which calls a remote service to expand some terms,
+// e.g. to download a favicon. Those terms are kept as they are when the query is only planned
+type RemoteExpander interface {
+	Expander
+
+	// Remote reports whether expanding the term calls the remote service
+	Remote(t *TermNode) bool
+}
+
+var (
+	expanderMu sync.RWMutex
+	expanders  = make(map[string]Expander)
+)
+
+func init() {
+	RegisterExpander(domainCertExpander{})
+	RegisterExpander(domainSubdomainExpander{})
+	RegisterExpander(orgICPExpander{})
+	RegisterExpander(&faviconExpander{})
+	RegisterExpander(ipCIDRExpander{})
+}
+
+// RegisterExpander makes the expander available by its name, a registered name is replaced
+func RegisterExpander(e Expander) {
+	expanderMu.Lock()
+	defer expanderMu.Unlock()
+	expanders[e.Name()] = e
+}
+
+// LookupExpander returns the registered expander of the name
+func LookupExpander(name string) (Expander, bool) {
+	expanderMu.RLock()
+	defer expanderMu.RUnlock()
+	e, ok := expanders[name]
+	return e, ok
+}
+
+// Expanders returns the sorted names of the registered expanders
+func Expanders() []string {
+	expanderMu.RLock()
+	defer expanderMu.RUnlock()
+	names := make([]string, 0, len(expanders))
+	for name := range expanders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Expand applies the expanders to every term of the node for the grammar.
+// Negated terms are kept as they are, widening them would exclude more assets.
+// When several expanders widen a term, their alternatives are joined with OR
+func Expand(ctx context.Context, node Node, g *Grammar, expanders ...Expander) (Node, error) {
+	switch n := node.(type) {
+	case *TermNode:
+		var alternatives []Node
+		for _, e := range expanders {
+			expanded, err := e.Expand(ctx, n, g)
+			if err != nil {
+				return nil, fmt.Errorf("expander %s: %w", e.Name(), err)
+			}
+			if expanded != nil {
+				alternatives = appendAlternatives(alternatives, expanded)
+			}
+		}
+		if len(alternatives) == 0 {
+			return n, nil
+		}
+		return orNodes(alternatives), nil
+	case *NotNode:
+		return n, nil
+	case *BinaryNode:
+		left, err := Expand(ctx, n.Left, g, expanders...)
+		if err != nil {
+			return nil, err
+		}
+		right, err := Expand(ctx, n.Right, g, expanders...)
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryNode{Op: n.Op, Left: left, Right: right}, nil
+	default:
+		return node, nil
+	}
+}
+
+// appendAlternatives adds the OR operands of node which are not in alternatives yet
+func appendAlternatives(alternatives []Node, node Node) []Node {
+	if b, ok := node.(*BinaryNode); ok && b.Op == OpOr {
+		return appendAlternatives(appendAlternatives(alternatives, b.Left), b.Right)
+	}
+	for _, alt := range alternatives {
+		if alt.String() == node.String() {
+			return alternatives
+		}
+	}
+	return append(alternatives, node)
+}
+
+func orNodes(nodes []Node) Node {
+	node := nodes[0]
+	for _, n := range nodes[1:] {
+		node = &BinaryNode{Op: OpOr, Left: node, Right: n}
+	}
+	return node
+}
+
+// widen returns t OR the alternative terms the grammar supports, or nil if none is supported
+func widen(t *TermNode, g *Grammar, alternatives ...*TermNode) Node {
+	var node Node = t
+	for _, alt := range alternatives {
+		if g.Supports(alt.Field) {
+			node = &BinaryNode{Op: OpOr, Left: node, Right: alt}
+		}
+	}
+	if node == Node(t) {
+		return nil
+	}
+	return node
+}
+
+// domainCertExpander searches the domain in tls certificates too
+type domainCertExpander struct{}
+
+func (domainCertExpander) Name() string { return "domain-cert" }
+
+func (domainCertExpander) Expand(_ context.Context, t *TermNode, g *Grammar) (Node, error) {
+	if t.Field != FieldDomain || t.Value == "" {
+		return nil, nil
+	}
+	return widen(t, g, &TermNode{Field: FieldCert, Value: t.Value}), nil
+}
+
+// domainSubdomainExpander searches the subdomains of the domain too
+type domainSubdomainExpander struct{}
+
+func (domainSubdomainExpander) Name() string { return "domain-subdomain" }
+
+func (domainSubdomainExpander) Expand(_ context.Context, t *TermNode, g *Grammar) (Node, error) {
+	if t.Field != FieldDomain || t.Value == "" {
+		return nil, nil
+	}
+	return widen(t, g, &TermNode{Field: FieldSubdomain, Value: t.Value}), nil
+}
+
+// orgICPExpander searches the organization as ICP unit too
+type orgICPExpander struct{}
+
+func (orgICPExpander) Name() string { return "org-icp" }
+
+func (orgICPExpander) Expand(_ context.Context, t *TermNode, g *Grammar) (Node, error) {
+	if t.Field != FieldOrg || t.Value == "" {
+		return nil, nil
+	}
+	return widen(t, g, &TermNode{Field: FieldICPUnit, Value: t.Value}), nil
+}
+
+// ipCIDRExpander searches the /24 network of an ipv4 address
+type ipCIDRExpander struct{}
+
+func (ipCIDRExpander) Name() string { return "ip-cidr" }
+
+func (ipCIDRExpander) Expand(_ context.Context, t *TermNode, g *Grammar) (Node, error) {
+	if t.Field != FieldIP || !g.Supports(FieldCIDR) {
+		return nil, nil
+	}
+	ip := net.ParseIP(t.Value).To4()
+	if ip == nil {
+		return nil, nil
+	}
+	network := &net.IPNet{IP: ip.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}
+	return &TermNode{Field: FieldCIDR, Value: network.String()}, nil
+}
+
+// faviconExpander resolves a favicon url, e.g. favicon:"https://example.com/favicon.ico",
+// into the md5 and mmh3 hashes of the icon, so each provider searches the hash family it indexes.
+// The icon is downloaded once per url, at search time only.
+// A hash value is kept as it is: md5 and mmh3 are hashes of the icon bytes,
+// one can't be computed from the other, so search with the icon url to cover both families
+type faviconExpander struct {
+	hashes sync.Map // url -> [2]string{md5, mmh3}
+}
+
+func (*faviconExpander) Name() string { return "favicon" }
+
+// Remote reports whether the term is a favicon url, which is downloaded to be expanded
+func (*faviconExpander) Remote(t *TermNode) bool {
+	if t.Field != FieldFavicon && t.Field != FieldIconHash {
+		return false
+	}
+	return strings.HasPrefix(t.Value, "http://") || strings.HasPrefix(t.Value, "https://")
+}
+
+func (e *faviconExpander) Expand(ctx context.Context, t *TermNode, g *Grammar) (Node, error) {
+	if !e.Remote(t) {
+		return nil, nil
+	}
+
+	hashes, err := e.hash(ctx, t.Value)
+	if err != nil {
+		return nil, err
+	}
+	var alternatives []Node
+	if g.Supports(FieldFavicon) {
+		alternatives = append(alternatives, &TermNode{Field: FieldFavicon, Value: hashes[0]})
+	}
+	if g.Supports(FieldIconHash) {
+		alternatives = append(alternatives, &TermNode{Field: FieldIconHash, Value: hashes[1]})
+	}
+	if len(alternatives) == 0 {
+		return nil, nil
+	}
+	return orNodes(alternatives), nil
+}
+
+func (e *faviconExpander) hash(ctx context.Context, url string) ([2]string, error) {
+	if hashes, ok := e.hashes.Load(url); ok {
+		return hashes.([2]string), nil
+	}
+
+	resp, err := DefaultClient.GetWithContext(ctx, url, nil)
+	if err != nil {
+		return [2]string{}, err
+	}
+	if resp.StatusCode != 200 || len(resp.Bytes()) == 0 {
+		return [2]string{}, errors.New("can't download favicon " + url)
+	}
+	icon := resp.Bytes()
+	sum := md5.Sum(icon)
+	hashes := [2]string{
+		hex.EncodeToString(sum[:]),
+		strconv.Itoa(int(mmh3(encodeBase64Lines(icon)))),
+	}
+	e.hashes.Store(url, hashes)
+	return hashes, nil
+}
+
+// encodeBase64Lines encodes data into base64 lines of 76 characters, each ending with a newline,
+// which is the input of the mmh3 favicon hash
+func encodeBase64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var sb strings.Builder
+	for len(encoded) > 76 {
+		sb.WriteString(encoded[:76])
+		sb.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	sb.WriteString(encoded)
+	sb.WriteByte('\n')
+	return []byte(sb.String())
+}
+
+// mmh3 returns the 32 bits murmur3 hash of data with seed 0
+func mmh3(data []byte) int32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+	var h uint32
+
+	nblocks := len(data) / 4
+	for i := 0; i < nblocks; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[nblocks*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return int32(h)
+}
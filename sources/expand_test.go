@@ -0,0 +1,69 @@
+package sources
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMmh3(t *testing.T) {
+	tests := []struct {
+		data string
+		want int32
+	}{
+		{"", 0},
+		{"hello", 613153351},
+		{"hello, world", 345750399},
+	}
+	for _, tt := range tests {
+		if got := mmh3([]byte(tt.data)); got != tt.want {
+			t.Errorf("mmh3(%q) = %d, want %d", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeBase64Lines(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"hello", "aGVsbG8=\n"},
+		{strings.Repeat("a", 57), strings.Repeat("YWFh", 19) + "\n"},
+		{strings.Repeat("a", 60), strings.Repeat("YWFh", 19) + "\nYWFh\n"},
+	}
+	for _, tt := range tests {
+		if got := string(encodeBase64Lines([]byte(tt.data))); got != tt.want {
+			t.Errorf("encodeBase64Lines(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestFaviconExpand(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	both := &Grammar{Fields: map[string]Field{FieldFavicon: {Keyword: "favicon"}, FieldIconHash: {Keyword: "icon_hash"}}}
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"url", server.URL + "/favicon.ico", `favicon:"5d41402abc4b2a76b9719d911017c592" || icon_hash:"1155597304"`},
+		{"hash kept", "5d41402abc4b2a76b9719d911017c592", `favicon:"5d41402abc4b2a76b9719d911017c592"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := Expand(context.Background(), &TermNode{Field: FieldFavicon, Value: tt.value}, both, &faviconExpander{})
+			if err != nil {
+				t.Fatalf("Expand() error = %v", err)
+			}
+			if got := node.String(); got != tt.want {
+				t.Errorf("Expand() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package sources
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Fields of the neutral query grammar, each provider grammar declares which of them it supports
+const (
+	FieldIP         = "ip"          // ip address
+	FieldCIDR       = "cidr"        // ip network, e.g. 1.1.1.0/24
+	FieldPort       = "port"        // port number
+	FieldProtocol   = "protocol"    // service protocol, e.g. ssh
+	FieldCountry    = "country"     // country code, english or chinese name, e.g. CN
+	FieldRegion     = "region"      // province or state
+	FieldCity       = "city"        // city
+	FieldASN        = "asn"         // autonomous system number
+	FieldOrg        = "org"         // organization owning the ip
+	FieldDomain     = "domain"      // domain
+	FieldSubdomain  = "subdomain"   // subdomains of a domain, e.g. example.com for www.example.com
+	FieldHeader     = "header"      // http response header
+	FieldTitle      = "title"       // html title
+	FieldBody       = "body"        // http response body
+	FieldServer     = "server"      // http server header
+	FieldApp        = "app"         // product or app fingerprint
+	FieldStatusCode = "status_code" // http status code
+	FieldFavicon    = "favicon"     // md5 hash of the favicon
+	FieldIconHash   = "icon_hash"   // mmh3 hash of the favicon
+	FieldCert       = "cert"        // tls certificate
+	FieldICP        = "icp"         // ICP licence, e.g. 京ICP证030173号
+	FieldICPUnit    = "icp_unit"    // ICP unit, e.g. 北京百度网讯科技有限公司
+)
+
+// country is an entry of the country table
+type country struct {
+	Code   string // ISO 3166-1 alpha-2
+	Name   string
+	NameCN string
+}
+
+var countries = []country{
+	{"CN", "China", "中国"},
+	{"HK", "Hong Kong", "中国香港"},
+	{"MO", "Macao", "中国澳门"},
+	{"TW", "Taiwan", "中国台湾"},
+	{"US", "United States", "美国"},
+	{"CA", "Canada", "加拿大"},
+	{"MX", "Mexico", "墨西哥"},
+	{"BR", "Brazil", "巴西"},
+	{"AR", "Argentina", "阿根廷"},
+	{"GB", "United Kingdom", "英国"},
+	{"DE", "Germany", "德国"},
+	{"FR", "France", "法国"},
+	{"NL", "Netherlands", "荷兰"},
+	{"IT", "Italy", "意大利"},
+	{"ES", "Spain", "西班牙"},
+	{"SE", "Sweden", "瑞典"},
+	{"CH", "Switzerland", "瑞士"},
+	{"PL", "Poland", "波兰"},
+	{"UA", "Ukraine", "乌克兰"},
+	{"RU", "Russia", "俄罗斯"},
+	{"TR", "Turkey", "土耳其"},
+	{"IN", "India", "印度"},
+	{"JP", "Japan", "日本"},
+	{"KR", "South Korea", "韩国"},
+	{"SG", "Singapore", "新加坡"},
+	{"MY", "Malaysia", "马来西亚"},
+	{"TH", "Thailand", "泰国"},
+	{"VN", "Vietnam", "越南"},
+	{"ID", "Indonesia", "印度尼西亚"},
+	{"PH", "Philippines", "菲律宾"},
+	{"AU", "Australia", "澳大利亚"},
+	{"NZ", "New Zealand", "新西兰"},
+	{"IR", "Iran", "伊朗"},
+	{"IL", "Israel", "以色列"},
+	{"SA", "Saudi Arabia", "沙特阿拉伯"},
+	{"AE", "United Arab Emirates", "阿联酋"},
+	{"EG", "Egypt", "埃及"},
+	{"ZA", "South Africa", "南非"},
+}
+
+// lookupCountry finds a country of the table by its code, english or chinese name
+func lookupCountry(value string) (country, error) {
+	value = strings.TrimSpace(value)
+	for _, c := range countries {
+		if strings.EqualFold(c.Code, value) || strings.EqualFold(c.Name, value) || c.NameCN == value {
+			return c, nil
+		}
+	}
+	return country{}, fmt.Errorf("unknown country %q", value)
+}
+
+// isCountryCode reports whether value has the shape of an ISO 3166-1 alpha-2 code, e.g. NO
+func isCountryCode(value string) bool {
+	if len(value) != 2 {
+		return false
+	}
+	for _, c := range value {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// transformCountry returns the form of the country given by name,
+// a code out of the table is passed as it is, since every provider accepts the codes
+func transformCountry(value string, name func(country) string) (string, error) {
+	c, err := lookupCountry(value)
+	if err == nil {
+		return name(c), nil
+	}
+	if code := strings.TrimSpace(value); isCountryCode(code) {
+		return strings.ToUpper(code), nil
+	}
+	return "", err
+}
+
+// CountryCode transforms a country value into its ISO 3166-1 alpha-2 code, e.g. China to CN
+func CountryCode(value string) (string, error) {
+	return transformCountry(value, func(c country) string { return c.Code })
+}
+
+// CountryName transforms a country value into its english name, e.g. CN to China
+func CountryName(value string) (string, error) {
+	return transformCountry(value, func(c country) string { return c.Name })
+}
+
+// CountryNameCN transforms a country value into its chinese name, e.g. CN to 中国
+func CountryNameCN(value string) (string, error) {
+	return transformCountry(value, func(c country) string { return c.NameCN })
+}
@@ -0,0 +1,49 @@
+package sources_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+	"github.com/N0el4kLs/cyberetrieve/sources/fofa"
+	"github.com/N0el4kLs/cyberetrieve/sources/hunter"
+	"github.com/N0el4kLs/cyberetrieve/sources/quake"
+)
+
+func TestCountryTranslate(t *testing.T) {
+	tests := []struct {
+		name    string
+		grammar *sources.Grammar
+		query   string
+		want    string
+	}{
+		{"fofa name", fofa.Grammar, `country:"China"`, `country="CN"`},
+		{"fofa code out of table", fofa.Grammar, `country:"NO"`, `country="NO"`},
+		{"quake code", quake.Grammar, `country:"cn"`, `country: "China"`},
+		{"quake code out of table", quake.Grammar, `country:"no"`, `country: "NO"`},
+		{"hunter chinese name", hunter.Grammar, `country:"日本"`, `ip.country="日本"`},
+		{"hunter code out of table", hunter.Grammar, `country:"NO"`, `ip.country="NO"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.grammar.Translate(tt.query)
+			if err != nil {
+				t.Fatalf("Translate(%q) error = %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("Translate(%q) = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountryUntranslatable(t *testing.T) {
+	for _, grammar := range []*sources.Grammar{fofa.Grammar, quake.Grammar, hunter.Grammar} {
+		for _, query := range []string{`country:"Norway"`, `port:80 && country:"NOR"`} {
+			_, err := grammar.Translate(query)
+			if !errors.Is(err, sources.ErrUntranslatable) {
+				t.Errorf("%s Translate(%q) error = %v, want ErrUntranslatable", grammar.Name, query, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package fofa
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+// BASE_FIELDS is the FOFA fields always requested, the url of a result is built from them
+var BASE_FIELDS = []string{"ip", "host", "port", "domain", "protocol"}
+
+// DEFAULT_FIELDS is the FOFA fields requested when Options.Fields is empty
+var DEFAULT_FIELDS = []string{"ip", "host", "port", "domain", "protocol", "icp", "title", "server"}
+
+// Options is the options of the FOFA provider, set with cyberetrieve.WithProviderOptions
+type Options struct {
+	// Fields is the FOFA fields to request, e.g. title, cert, lastupdatetime,
+	// BASE_FIELDS are always requested. The fields without a Result field are only kept in Result.Raw.
+	// Some fields need a FOFA membership level, see https://fofa.info/api
+	Fields []string
+
+	// Full searches all the data instead of the data of the last year
+	Full bool
+}
+
+// fields returns the fields to request, BASE_FIELDS first
+func (o Options) fields() []string {
+	requested := o.Fields
+	if len(requested) == 0 {
+		requested = DEFAULT_FIELDS
+	}
+
+	fields := make([]string, 0, len(BASE_FIELDS)+len(requested))
+	seen := make(map[string]bool, cap(fields))
+	for _, field := range append(append([]string{}, BASE_FIELDS...), requested...) {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" || seen[field] {
+			continue
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// fieldSetters sets the Result field of a FOFA field from its value
+var fieldSetters = map[string]func(r *sources.Result, value string){
+	"ip":              func(r *sources.Result, value string) { r.IP = value },
+	"host":            func(r *sources.Result, value string) { r.Host = value },
+	"port":            func(r *sources.Result, value string) { r.Port, _ = strconv.Atoi(value) },
+	"domain":          func(r *sources.Result, value string) { r.Domain = value },
+	"protocol":        func(r *sources.Result, value string) { r.Protocol = value },
+	"base_protocol":   func(r *sources.Result, value string) { r.Transport = value },
+	"icp":             func(r *sources.Result, value string) { r.ICPLicence = value },
+	"title":           func(r *sources.Result, value string) { r.Title = value },
+	"server":          func(r *sources.Result, value string) { r.Server = value },
+	"status_code":     func(r *sources.Result, value string) { r.StatusCode, _ = strconv.Atoi(value) },
+	"os":              func(r *sources.Result, value string) { r.OS = value },
+	"banner":          func(r *sources.Result, value string) { r.Banner = value },
+	"country":         func(r *sources.Result, value string) { r.Country = sources.NormalizeCountry(value, r.Country) },
+	"country_name":    func(r *sources.Result, value string) { r.Country = sources.NormalizeCountry(value, r.Country) },
+	"region":          func(r *sources.Result, value string) { r.Region = value },
+	"city":            func(r *sources.Result, value string) { r.City = value },
+	"as_number":       func(r *sources.Result, value string) { r.ASN, _ = strconv.Atoi(value) },
+	"as_organization": func(r *sources.Result, value string) { r.Org = value },
+	"lastupdatetime":  func(r *sources.Result, value string) { r.Timestamp = sources.ParseTime(value) },
+	"product": func(r *sources.Result, value string) {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				r.Components = append(r.Components, sources.Component{Name: name})
+			}
+		}
+	},
+}
+
+// newResult maps the values of a FOFA result item to a Result by the requested fields,
+// in whatever order they are
+func newResult(fields []string, item []string) *sources.Result {
+	result := &sources.Result{Provider: FOFA}
+	for i, value := range item {
+		if i >= len(fields) {
+			break
+		}
+		if setter, ok := fieldSetters[fields[i]]; ok {
+			setter(result, value)
+		}
+	}
+
+	if strings.HasPrefix(result.Host, "http") {
+		result.URL = result.Host
+	} else if result.Host != "" {
+		result.URL = fmt.Sprintf("%s://%s", result.Protocol, result.Host)
+	}
+	return result
+}
@@ -0,0 +1,77 @@
+package fofa
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+func TestOptionsFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		want   []string
+	}{
+		{"default", nil, []string{"ip", "host", "port", "domain", "protocol", "icp", "title", "server"}},
+		{"base first", []string{"title", "ip"}, []string{"ip", "host", "port", "domain", "protocol", "title"}},
+		{"normalized", []string{" Title ", "title", "", "CERT"}, []string{"ip", "host", "port", "domain", "protocol", "title", "cert"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Options{Fields: tt.fields}).fields(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fields() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		item   []string
+		want   sources.Result
+	}{
+		{
+			name:   "default fields",
+			fields: DEFAULT_FIELDS,
+			item:   []string{"1.1.1.1", "example.com:8080", "8080", "example.com", "http", "京ICP备00000000号", "login", "nginx"},
+			want: sources.Result{
+				IP: "1.1.1.1", Host: "example.com:8080", URL: "http://example.com:8080", Port: 8080, Domain: "example.com",
+				Protocol: "http", ICPLicence: "京ICP备00000000号", Title: "login", Server: "nginx",
+			},
+		},
+		{
+			name:   "url host",
+			fields: []string{"host", "port", "protocol"},
+			item:   []string{"https://example.com", "443", "https"},
+			want:   sources.Result{Host: "https://example.com", URL: "https://example.com", Port: 443, Protocol: "https"},
+		},
+		{
+			name:   "any order",
+			fields: []string{"port", "country_name", "ip", "as_number", "as_organization", "lastupdatetime", "product", "base_protocol"},
+			item:   []string{"22", "China", "1.1.1.1", "4134", "Chinanet", "2024-01-02 03:04:05", "OpenSSH, Ubuntu", "tcp"},
+			want: sources.Result{
+				IP: "1.1.1.1", Port: 22, Country: "CN", ASN: 4134, Org: "Chinanet", Transport: "tcp",
+				Timestamp:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				Components: []sources.Component{{Name: "OpenSSH"}, {Name: "Ubuntu"}},
+			},
+		},
+		{
+			name:   "unknown and missing fields",
+			fields: []string{"ip", "fid", "port"},
+			item:   []string{"1.1.1.1", "abc"},
+			want:   sources.Result{IP: "1.1.1.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.want.Provider = FOFA
+			if got := newResult(tt.fields, tt.item); !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("newResult() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,9 @@
 package fofa
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/N0el4kLs/cyberetrieve/sources"
@@ -12,16 +12,41 @@ import (
 )
 
 const (
-	FOFA     = "FOFA"
-	BASE_URL = "https://fofa.info/api/v1/"
-	AUTH_URL = "https://fofa.info/api/v1/info/my?key=%s"
-)
+	FOFA       = "FOFA"
+	BASE_URL   = "https://fofa.info/api/v1/"
+	AUTH_URL   = "https://fofa.info/api/v1/info/my?key=%s"
+	SEARCH_URL = BASE_URL + "search/all?key=%s"
 
-var (
-	AUTHED_SEARCH_URL = BASE_URL + "search/all?key=%s"
+	// SESSION_KEY is the key of the FOFA key in sources.Session.Keys
+	SESSION_KEY = "fofa"
 )
 
+func init() {
+	sources.RegisterProvider(sources.ProviderInfo{
+		Name: FOFA,
+		New:  func() sources.Provider { return &Provider{} },
+	})
+}
+
 type Provider struct {
+	// key is the FOFA API key, it's set by a successful Auth
+	key string
+
+	// options is the options set by Configure
+	options Options
+}
+
+// Configure sets the FOFA options, options is an Options or *Options
+func (p *Provider) Configure(options interface{}) error {
+	switch o := options.(type) {
+	case Options:
+		p.options = o
+	case *Options:
+		p.options = *o
+	default:
+		return fmt.Errorf("%T is not fofa.Options", options)
+	}
+	return nil
 }
 
 // Name returns the name of the provider
@@ -29,55 +54,83 @@ func (p *Provider) Name() string {
 	return FOFA
 }
 
+// Grammar returns the FOFA grammar translator
+func (p *Provider) Grammar() *sources.Grammar {
+	return Grammar
+}
+
 // Auth checks if the provider is valid to use
-func (p *Provider) Auth(s *sources.Session) bool {
-	if s.FofaKey == "" {
-		return false
+func (p *Provider) Auth(ctx context.Context, s *sources.Session) (bool, error) {
+	key := s.Key(SESSION_KEY)
+	if key == "" {
+		return false, nil
 	}
-	infoUrl := fmt.Sprintf(AUTH_URL, s.FofaKey)
+	infoUrl := fmt.Sprintf(AUTH_URL, key)
 	client := sources.DefaultClient
-	resp, err := client.Get(infoUrl, nil)
+	resp, err := client.GetWithContext(ctx, infoUrl, nil)
 	if err != nil {
-		return false
+		return false, sources.RequestError(FOFA, err)
+	}
+	if err = sources.AuthError(FOFA, resp.StatusCode, ""); err != nil {
+		return false, err
 	}
 	//fmt.Printf("Fofa Auth Result: %s \n", resp.String())
 	if !strings.Contains(resp.String(), `"error":false`) {
-		return false
+		return false, nil
 	}
-	AUTHED_SEARCH_URL = fmt.Sprintf(AUTHED_SEARCH_URL, s.FofaKey)
-	return true
+	p.key = key
+	return true, nil
+}
+
+// PageSize returns the page size to fetch numberOfQuery results
+func (p *Provider) PageSize(numberOfQuery int) int {
+	pageSize := sources.DEFAULT_PAGE_SIZE
+	if numberOfQuery < pageSize {
+		pageSize = numberOfQuery
+	}
+	if numberOfQuery > sources.DEFAULT_PAGE_SIZE_MAX || numberOfQuery == -1 {
+		pageSize = sources.DEFAULT_PAGE_SIZE_MAX
+	}
+	return pageSize
 }
 
 // Search the result with provider
-func (p *Provider) Search(query *sources.Query) (chan *sources.Result, error) {
-	results := make(chan *sources.Result)
+func (p *Provider) Search(ctx context.Context, query *sources.Query) (*sources.Stream, error) {
+	stream := sources.NewStream()
 	go func() {
-		defer close(results)
+		var err error
+		defer func() { stream.Close(err) }()
 		numberOfResult := 0
-		pageSize := sources.DEFAULT_PAGE_SIZE
-		if query.NumberOfQuery < pageSize {
-			pageSize = query.NumberOfQuery
-		}
-		if query.NumberOfQuery > sources.DEFAULT_PAGE_SIZE_MAX || query.NumberOfQuery == -1 {
-			pageSize = sources.DEFAULT_PAGE_SIZE_MAX
-		}
+		pageSize := p.PageSize(query.NumberOfQuery)
 
 		page := 1
 		querySentence := query.Query
 		// If AutoGrammar is on, use transferred grammar
-		if query.FofaQuery != "" {
-			querySentence = query.FofaQuery
+		if native := query.Native(p.Name()); native != "" {
+			querySentence = native
 		}
 		gologger.Info().Msgf("Provider %s search grammar: %s \n", p.Name(), querySentence)
+		fields := p.options.fields()
 
 		for {
-			queryFiled := NewFofaSearchFiled(querySentence, page, pageSize)
+			queryFiled := NewFofaSearchFiled(querySentence, page, pageSize, fields, p.options.Full)
 
-			currentSearchResult := p.query(queryFiled, results)
+			var currentSearchResult *FofaSearchResult
+			currentSearchResult, err = p.query(ctx, queryFiled, fields, query.IncludeRaw, stream.Results)
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				gologger.Info().Label("Provider").
+					Msgf("%s search cancelled. You've found %d items\n", p.Name(), numberOfResult)
+				break
+			}
+			if err != nil {
+				gologger.Error().Label("Provider").
+					Msgf("%s search error: %s. You've found %d items\n", p.Name(), err, numberOfResult)
+				break
+			}
 			numberOfResult += len(currentSearchResult.Results)
 
 			if !isValidResult(currentSearchResult) || isOverSize(numberOfResult, query.NumberOfQuery) {
-				// todo need refactor error handle chain
 				gologger.Info().Label("Provider").
 					Msgf("%s search done. You've found %d items\n", p.Name(), numberOfResult)
 				break
@@ -86,56 +139,63 @@ func (p *Provider) Search(query *sources.Query) (chan *sources.Result, error) {
 		}
 	}()
 
-	return results, nil
+	return stream, nil
 }
 
-func (p *Provider) query(queryFiled *FofaSearchFiled, results chan *sources.Result) *FofaSearchResult {
-	SEARCH_URL := AUTHED_SEARCH_URL +
-		"&qbase64=%s" +
-		"&page=%d" +
-		"&size=%d" +
-		"&full=%s" +
-		"&fields=%s"
-
-	searchUrl := fmt.Sprintf(SEARCH_URL,
+func (p *Provider) query(ctx context.Context, queryFiled *FofaSearchFiled, fields []string, raw bool, results chan *sources.Result) (*FofaSearchResult, error) {
+	searchUrl := fmt.Sprintf(SEARCH_URL+
+		"&qbase64=%s"+
+		"&page=%d"+
+		"&size=%d"+
+		"&full=%s"+
+		"&fields=%s",
+		p.key,
 		queryFiled.Query,
 		queryFiled.Page,
 		queryFiled.Size,
 		queryFiled.Full,
 		queryFiled.Fields,
 	)
-	resp, err := sources.DefaultClient.Get(searchUrl, nil)
+	resp, err := sources.DefaultClient.GetWithContext(ctx, searchUrl, nil)
 	if err != nil {
 		gologger.Debug().Msgf("Fofa Search Error: %s \n", err)
-		return nil
+		return nil, sources.RequestError(FOFA, err)
 	}
 	fofaSearchResults := &FofaSearchResult{}
 	err = resp.Into(fofaSearchResults)
 	//gologger.Debug().Msgf("Fofa Search Result: %#v \n", fofaSearchResults)
 	if err != nil {
 		gologger.Debug().Msgf("Fofa search result unmarshal error: %s \n", err)
-		return nil
+		if resp.StatusCode != 200 {
+			return nil, sources.ResponseError(FOFA, resp.StatusCode, "")
+		}
+		return nil, sources.DecodeError(FOFA, err)
+	}
+	if fofaSearchResults.Error || resp.StatusCode != 200 {
+		return nil, sources.ResponseError(FOFA, resp.StatusCode, fofaSearchResults.ErrMsg)
 	}
 
 	for _, item := range fofaSearchResults.Results {
-		searchResult := &sources.Result{}
-		searchResult.IP = item[0]
-		searchResult.Host = item[1]
-		searchResult.Port, _ = strconv.Atoi(item[2])
-		searchResult.Domain = item[3]
-		//protocol = item[4]
-		var url string
-		if strings.HasPrefix(item[1], "http") {
-			url = item[1]
-		} else {
-			url = fmt.Sprintf("%s://%s", item[4], item[1])
+		searchResult := newResult(fields, item)
+		if raw {
+			// the item is a plain list of the fields, it's keyed by field name to be readable on its own
+			values := make(map[string]string, len(item))
+			for i, value := range item {
+				if i < len(fields) {
+					values[fields[i]] = value
+				}
+			}
+			searchResult.Raw, _ = json.Marshal(values)
 		}
-		searchResult.URL = url
 
-		results <- searchResult
+		select {
+		case results <- searchResult:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 
-	return fofaSearchResults
+	return fofaSearchResults, nil
 }
 
 // isOverSize check if the number of result is over the number of query which is required
@@ -163,56 +223,69 @@ func isValidResult(result *FofaSearchResult) bool {
 	return true
 }
 
-func ToFofaGrammar(s string) (string, error) {
-	var (
-		query      string
-		subQueries []string
-	)
-	if strings.Contains(s, "&&") {
-		subQueries = strings.Split(s, "&&")
-	} else {
-		subQueries = append(subQueries, s)
-	}
+// Grammar renders the neutral query AST into FOFA search grammar
+var Grammar = &sources.Grammar{
+	Name:      FOFA,
+	And:       " && ",
+	Or:        " || ",
+	Operators: sources.OpAnd | sources.OpOr | sources.OpNot,
+	Fields: map[string]sources.Field{
+		sources.FieldIP:         {Keyword: "ip"},
+		sources.FieldCIDR:       {Keyword: "ip"},
+		sources.FieldPort:       {Keyword: "port", Numeric: true},
+		sources.FieldProtocol:   {Keyword: "protocol"},
+		sources.FieldCountry:    {Keyword: "country", Transform: sources.CountryCode},
+		sources.FieldRegion:     {Keyword: "region"},
+		sources.FieldCity:       {Keyword: "city"},
+		sources.FieldASN:        {Keyword: "asn", Numeric: true},
+		sources.FieldOrg:        {Keyword: "org"},
+		sources.FieldDomain:     {Keyword: "domain"},
+		sources.FieldSubdomain:  {Keyword: "host", Transform: subdomainHost, Reverse: hostSubdomain},
+		sources.FieldHeader:     {Keyword: "header"},
+		sources.FieldTitle:      {Keyword: "title"},
+		sources.FieldBody:       {Keyword: "body"},
+		sources.FieldServer:     {Keyword: "server"},
+		sources.FieldApp:        {Keyword: "app"},
+		sources.FieldStatusCode: {Keyword: "status_code", Numeric: true},
+		sources.FieldIconHash:   {Keyword: "icon_hash", Numeric: true},
+		sources.FieldCert:       {Keyword: "cert"},
+		sources.FieldICP:        {Keyword: "icp"},
+	},
+	Term:   parse2FofaKeywords,
+	Syntax: sources.SyntaxEqual,
+}
 
-	for _, q := range subQueries {
-		if st, err := parse2FofaKeywords(strings.TrimSpace(q)); err != nil {
-			return "", err
-		} else {
-			query += st + " && "
-		}
-	}
+// ToFofaGrammar translates the neutral query into FOFA search grammar
+func ToFofaGrammar(s string) (string, error) {
+	return Grammar.Translate(s)
+}
 
-	// handle the latest suffix
-	if strings.HasSuffix(query, "&& ") {
-		query = query[0 : len(query)-4]
+// FromFofaGrammar translates a FOFA query back into the neutral query
+func FromFofaGrammar(s string) (string, error) {
+	node, err := Grammar.Parse(s)
+	if err != nil {
+		return "", err
 	}
-	return query, nil
+	return node.String(), nil
 }
 
-func parse2FofaKeywords(s string) (string, error) {
+func parse2FofaKeywords(f sources.Field, t *sources.TermNode, negated bool) (string, error) {
 	var (
 		equalSymbol = "="
 	)
 
-	if strings.HasPrefix(strings.ToLower(s), "not ") {
+	if negated {
 		equalSymbol = "!="
-		s = s[4:]
-	}
-
-	keywords := strings.Split(s, ":")
-	keyword, search := keywords[0], keywords[1]
-	switch keyword {
-	case "ip":
-		return fmt.Sprintf("ip%s%s", equalSymbol, search), nil
-	case "domain":
-		return fmt.Sprintf("domain%s%s", equalSymbol, search), nil
-	case "header":
-		return fmt.Sprintf("headers%s%s", equalSymbol, search), nil
-	case "title":
-		return fmt.Sprintf("title%s%s", equalSymbol, search), nil
-	case "body":
-		return fmt.Sprintf("body%s%s", equalSymbol, search), nil
-	default:
-		return "", errors.New("transfer to FOFA grammar false")
 	}
+	return fmt.Sprintf("%s%s%s", f.Keyword, equalSymbol, sources.Quote(t.Value)), nil
+}
+
+// subdomainHost searches the subdomains of a domain in FOFA host, e.g. .example.com
+func subdomainHost(domain string) (string, error) {
+	return "." + strings.TrimPrefix(domain, "."), nil
+}
+
+// hostSubdomain is the reverse of subdomainHost
+func hostSubdomain(host string) string {
+	return strings.TrimPrefix(host, ".")
 }
@@ -1,6 +1,10 @@
 package fofa
 
-import "encoding/base64"
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
 
 type FofaSearchFiled struct {
 	Query  string
@@ -10,12 +14,13 @@ type FofaSearchFiled struct {
 	Full   string // 默认搜索一年内的数据，指定为true即可搜索全部数据
 }
 
-func NewFofaSearchFiled(query string, pageIndex, pageSize int) *FofaSearchFiled {
+// NewFofaSearchFiled returns the search of the query page, fields is the FOFA fields to request
+func NewFofaSearchFiled(query string, pageIndex, pageSize int, fields []string, full bool) *FofaSearchFiled {
 	return &FofaSearchFiled{
 		Query:  base64.StdEncoding.EncodeToString([]byte(query)),
 		Size:   pageSize,
 		Page:   pageIndex,
-		Fields: "ip,host,port,domain,protocol,icp",
-		Full:   "false",
+		Fields: strings.Join(fields, ","),
+		Full:   strconv.FormatBool(full),
 	}
 }
@@ -0,0 +1,314 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUntranslatable is matched by every UntranslatableError with errors.Is
+var ErrUntranslatable = errors.New("untranslatable query")
+
+// UntranslatableError reports a field or operator a provider grammar can't express,
+// or a construct of a native query which has no neutral equivalent
+type UntranslatableError struct {
+	Provider string
+	Field    string   // the neutral field, empty when an operator is unsupported
+	Operator Operator // the operator, 0 when a field is unsupported
+	Native   string   // the native construct, e.g. field icp, set when parsing a native query
+	Value    string   // the value of the field which can't be transformed, e.g. an unknown country
+}
+
+func (e *UntranslatableError) Error() string {
+	if e.Native != "" {
+		return fmt.Sprintf("%s %s has no neutral equivalent", e.Provider, e.Native)
+	}
+	if e.Field != "" && e.Value != "" {
+		return fmt.Sprintf("%s cannot translate field %s value %q", e.Provider, e.Field, e.Value)
+	}
+	if e.Field != "" {
+		return fmt.Sprintf("%s cannot translate field %s", e.Provider, e.Field)
+	}
+	return fmt.Sprintf("%s cannot translate operator %s", e.Provider, e.Operator)
+}
+
+func (e *UntranslatableError) Unwrap() error {
+	return ErrUntranslatable
+}
+
+// Field is the native form of a neutral field
+type Field struct {
+	// Keyword is the native field name, e.g. headers
+	Keyword string
+
+	// Numeric requires the value to be an integer, e.g. port
+	Numeric bool
+
+	// Transform optionally converts the neutral value into the native one,
+	// e.g. a country name into its code
+	Transform func(value string) (string, error)
+
+	// Reverse optionally converts the native value back into the neutral one
+	Reverse func(value string) string
+}
+
+// value returns the native value of the neutral term value,
+// a value the Transform can't convert is reported as *UntranslatableError
+func (f Field) value(provider string, t *TermNode) (string, error) {
+	if _, err := strconv.Atoi(t.Value); f.Numeric && err != nil {
+		return "", fmt.Errorf("field %s expects a number, got %q", t.Field, t.Value)
+	}
+	if f.Transform == nil {
+		return t.Value, nil
+	}
+	value, err := f.Transform(t.Value)
+	if err != nil {
+		return "", &UntranslatableError{Provider: provider, Field: t.Field, Value: t.Value}
+	}
+	return value, nil
+}
+
+// Syntax is the shape of a native query grammar
+type Syntax uint8
+
+const (
+	// SyntaxColon is field: "value" joined by AND, OR, NOT, like QUAKE and the neutral query
+	SyntaxColon Syntax = iota
+	// SyntaxEqual is field="value" and field!="value" joined by && and ||, like FOFA
+	SyntaxEqual
+)
+
+// Grammar describes how a provider renders the neutral query AST
+// into its own search grammar
+type Grammar struct {
+	// Name is the name of the provider, e.g. FOFA
+	Name string
+
+	// And is the symbol which joins two expressions, e.g. " && "
+	And string
+
+	// Or is the symbol which joins two alternative expressions, e.g. " || "
+	Or string
+
+	// Not negates a rendered expression, e.g. (NOT ...).
+	// If it's nil, negations are pushed down to the terms with De Morgan's laws
+	Not func(expr string) string
+
+	// Operators is the set of operators the provider can express
+	Operators Operator
+
+	// Fields maps the neutral fields the provider supports to their native form
+	Fields map[string]Field
+
+	// Term renders a single field term, negated is true when the term is under not
+	Term func(f Field, t *TermNode, negated bool) (string, error)
+
+	// Syntax is the shape of the native grammar, used to parse native queries
+	Syntax Syntax
+
+	// Native optionally parses a native term which doesn't map to a field, e.g. is_domain: true.
+	// It returns nil when the term is not special
+	Native func(keyword, value string) Node
+
+	// Escape optionally escapes a value placed between double quotes, default is Escape
+	Escape func(value string) string
+}
+
+// escape escapes a value placed between double quotes of the native grammar
+func (g *Grammar) escape(value string) string {
+	if g == nil || g.Escape == nil {
+		return Escape(value)
+	}
+	return g.Escape(value)
+}
+
+// Parse parses a native query of the provider back into the neutral query AST.
+// Native constructs without neutral equivalent are reported as *UntranslatableError
+func (g *Grammar) Parse(native string) (Node, error) {
+	return parse(native, g)
+}
+
+// neutral returns the neutral term of a native field search
+func (g *Grammar) neutral(keyword, value string) (Node, error) {
+	if g.Native != nil {
+		if node := g.Native(keyword, value); node != nil {
+			return node, nil
+		}
+	}
+
+	// several neutral fields may share a keyword, prefer the field named like it
+	name, ok := keyword, false
+	if f, found := g.Fields[keyword]; found && f.Keyword == keyword {
+		ok = true
+	} else {
+		names := make([]string, 0, len(g.Fields))
+		for n := range g.Fields {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			if strings.EqualFold(g.Fields[n].Keyword, keyword) {
+				name, ok = n, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, &UntranslatableError{Provider: g.Name, Native: "field " + keyword}
+	}
+
+	if reverse := g.Fields[name].Reverse; reverse != nil {
+		value = reverse(value)
+	}
+	return &TermNode{Field: name, Value: value}, nil
+}
+
+// Supports reports whether the neutral field can be expressed by the grammar
+func (g *Grammar) Supports(field string) bool {
+	_, ok := g.Fields[field]
+	return ok
+}
+
+// Check reports every field and operator of the query AST
+// the grammar can't express, the returned errors are *UntranslatableError
+func (g *Grammar) Check(node Node) []error {
+	var (
+		errs = make([]error, 0)
+		seen = make(map[UntranslatableError]struct{})
+	)
+	report := func(e UntranslatableError) {
+		if _, ok := seen[e]; !ok {
+			seen[e] = struct{}{}
+			errs = append(errs, &e)
+		}
+	}
+
+	var walk func(node Node, negated bool)
+	walk = func(node Node, negated bool) {
+		switch n := node.(type) {
+		case *TermNode:
+			if !g.Supports(n.Field) {
+				report(UntranslatableError{Provider: g.Name, Field: n.Field})
+			}
+			if negated && g.Operators&OpNot == 0 {
+				report(UntranslatableError{Provider: g.Name, Operator: OpNot})
+			}
+		case *NotNode:
+			walk(n.Expr, !negated)
+		case *BinaryNode:
+			if op := g.effectiveOp(n.Op, negated); g.Operators&op == 0 {
+				report(UntranslatableError{Provider: g.Name, Operator: op})
+			}
+			if negated && g.Not != nil {
+				if g.Operators&OpNot == 0 {
+					report(UntranslatableError{Provider: g.Name, Operator: OpNot})
+				}
+				negated = false
+			}
+			walk(n.Left, negated)
+			walk(n.Right, negated)
+		}
+	}
+	walk(node, false)
+	return errs
+}
+
+// Translate parses the neutral query and renders it with the grammar
+func (g *Grammar) Translate(query string) (string, error) {
+	node, err := ParseQuery(query)
+	if err != nil {
+		return "", err
+	}
+	return g.Render(node)
+}
+
+// Render renders the query AST with the grammar
+func (g *Grammar) Render(node Node) (string, error) {
+	s, _, err := g.render(node, false)
+	return s, err
+}
+
+// render returns the rendered node and the operator joining its top level,
+// the operator is 0 when the rendered expression is a single unit
+func (g *Grammar) render(node Node, negated bool) (string, Operator, error) {
+	switch n := node.(type) {
+	case *TermNode:
+		f, ok := g.Fields[n.Field]
+		if !ok {
+			return "", 0, &UntranslatableError{Provider: g.Name, Field: n.Field}
+		}
+		if negated && g.Operators&OpNot == 0 {
+			return "", 0, &UntranslatableError{Provider: g.Name, Operator: OpNot}
+		}
+		value, err := f.value(g.Name, n)
+		if err != nil {
+			return "", 0, err
+		}
+		s, err := g.Term(f, &TermNode{Field: n.Field, Value: value}, negated)
+		return s, 0, err
+	case *NotNode:
+		return g.render(n.Expr, !negated)
+	case *BinaryNode:
+		if negated && g.Not != nil {
+			if g.Operators&OpNot == 0 {
+				return "", 0, &UntranslatableError{Provider: g.Name, Operator: OpNot}
+			}
+			s, _, err := g.render(n, false)
+			if err != nil {
+				return "", 0, err
+			}
+			return g.Not("(" + s + ")"), 0, nil
+		}
+
+		op := g.effectiveOp(n.Op, negated)
+		if g.Operators&op == 0 {
+			return "", 0, &UntranslatableError{Provider: g.Name, Operator: op}
+		}
+		left, err := g.renderOperand(n.Left, op, negated)
+		if err != nil {
+			return "", 0, err
+		}
+		right, err := g.renderOperand(n.Right, op, negated)
+		if err != nil {
+			return "", 0, err
+		}
+		return left + g.symbol(op) + right, op, nil
+	default:
+		return "", 0, fmt.Errorf("%w: unknown node %T", ErrUntranslatable, node)
+	}
+}
+
+// renderOperand renders an operand of op, grouping it with parentheses
+// when it's joined by the other operator, so precedence never depends on the provider
+func (g *Grammar) renderOperand(node Node, op Operator, negated bool) (string, error) {
+	s, childOp, err := g.render(node, negated)
+	if err != nil {
+		return "", err
+	}
+	if childOp != 0 && childOp != op {
+		s = "(" + s + ")"
+	}
+	return s, nil
+}
+
+func (g *Grammar) symbol(op Operator) string {
+	if op == OpOr {
+		return g.Or
+	}
+	return g.And
+}
+
+// effectiveOp returns the operator a binary node is rendered with,
+// a negated node flips its operator when the negation is pushed down
+func (g *Grammar) effectiveOp(op Operator, negated bool) Operator {
+	if !negated || g.Not != nil {
+		return op
+	}
+	// not (a && b) == not a || not b, not (a || b) == not a && not b
+	if op == OpAnd {
+		return OpOr
+	}
+	return OpAnd
+}
@@ -0,0 +1,107 @@
+package sources_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+	"github.com/N0el4kLs/cyberetrieve/sources/fofa"
+	"github.com/N0el4kLs/cyberetrieve/sources/hunter"
+	"github.com/N0el4kLs/cyberetrieve/sources/quake"
+)
+
+func TestGrammarRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		grammar *sources.Grammar
+		query   string
+		want    string
+	}{
+		{"fofa de morgan and", fofa.Grammar, `not (title:a && port:80)`, `title!="a" || port!="80"`},
+		{"fofa de morgan or", fofa.Grammar, `not (title:a || port:80)`, `title!="a" && port!="80"`},
+		{"fofa de morgan nested", fofa.Grammar, `not (title:a && (port:80 || port:443))`, `title!="a" || (port!="80" && port!="443")`},
+		{"fofa double not", fofa.Grammar, `not not title:a`, `title="a"`},
+		{"fofa precedence", fofa.Grammar, `title:a || port:80 && ip:1.1.1.1`, `title="a" || (port="80" && ip="1.1.1.1")`},
+		{"fofa group", fofa.Grammar, `(title:a || port:80) && ip:1.1.1.1`, `(title="a" || port="80") && ip="1.1.1.1"`},
+		{"hunter de morgan", hunter.Grammar, `title:a && not (port:80 || port:443)`, `web.title="a" && ip.port!="80" && ip.port!="443"`},
+		{"quake not term", quake.Grammar, `not title:a`, `(NOT title: "a")`},
+		{"quake not group", quake.Grammar, `not (title:a && port:80)`, `(NOT (title: "a" AND port: 80))`},
+		{"quake not nested", quake.Grammar, `title:a && not (port:80 || port:443)`, `title: "a" AND (NOT (port: 80 OR port: 443))`},
+		{"quake precedence", quake.Grammar, `title:a || port:80 && ip:1.1.1.1`, `title: "a" OR (port: 80 AND ip: "1.1.1.1")`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.grammar.Translate(tt.query)
+			if err != nil {
+				t.Fatalf("Translate(%q) error = %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("Translate(%q) = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrammarRenderPushedDownOperator(t *testing.T) {
+	// without or, not (a && b) can't be pushed down to the terms
+	grammar := *fofa.Grammar
+	grammar.Operators = sources.OpAnd | sources.OpNot
+
+	_, err := grammar.Translate(`not (title:a && port:80)`)
+	var untranslatable *sources.UntranslatableError
+	if !errors.As(err, &untranslatable) || untranslatable.Operator != sources.OpOr {
+		t.Fatalf("Translate() error = %v, want operator or untranslatable", err)
+	}
+	if _, err = grammar.Translate(`not (title:a || port:80)`); err != nil {
+		t.Errorf("Translate() error = %v, want not (a || b) rendered with and", err)
+	}
+}
+
+func TestGrammarCheck(t *testing.T) {
+	noNot := *fofa.Grammar
+	noNot.Operators = sources.OpAnd | sources.OpOr
+
+	tests := []struct {
+		name    string
+		grammar *sources.Grammar
+		query   string
+		want    []string
+	}{
+		{"supported", hunter.Grammar, `title:a && (favicon:b || icp_unit:c)`, nil},
+		{"fofa fields", fofa.Grammar, `favicon:a && icp_unit:b || favicon:c`, []string{
+			"FOFA cannot translate field favicon",
+			"FOFA cannot translate field icp_unit",
+		}},
+		{"quake fields", quake.Grammar, `subdomain:a && not icon_hash:1`, []string{
+			"QUAKE cannot translate field subdomain",
+			"QUAKE cannot translate field icon_hash",
+		}},
+		{"operator", &noNot, `not title:a && not port:80`, []string{
+			"FOFA cannot translate operator not",
+		}},
+		{"pushed down operator", &noNot, `not (title:a || favicon:b)`, []string{
+			"FOFA cannot translate operator not",
+			"FOFA cannot translate field favicon",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := sources.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", tt.query, err)
+			}
+			errs := tt.grammar.Check(node)
+			got := make([]string, 0, len(errs))
+			for _, err := range errs {
+				if !errors.Is(err, sources.ErrUntranslatable) {
+					t.Errorf("Check() error %v is not ErrUntranslatable", err)
+				}
+				got = append(got, err.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Check(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
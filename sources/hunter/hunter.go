@@ -1,24 +1,130 @@
 package hunter
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/N0el4kLs/cyberetrieve/sources"
 	"github.com/projectdiscovery/gologger"
 )
 
 const (
-	HUNTER   = "HUNTER"
-	AUTH_URL = "https://hunter.qianxin.com/openApi/search?api-key="
-)
+	HUNTER     = "HUNTER"
+	AUTH_URL   = "https://hunter.qianxin.com/openApi/search?api-key="
+	SEARCH_URL = AUTH_URL
+
+	// SESSION_KEY is the key of the HUNTER key in sources.Session.Keys
+	SESSION_KEY = "hunter"
 
-var (
-	SEARCH_URL = ""
+	// minPageSize is the smallest page size hunter accepts
+	minPageSize = 10
 )
 
+func init() {
+	sources.RegisterProvider(sources.ProviderInfo{
+		Name: HUNTER,
+		New:  func() sources.Provider { return &Provider{} },
+	})
+}
+
 type Provider struct {
+	// key is the HUNTER API key, it's set by a successful Auth
+	key string
+
+	// options is the options set by Configure
+	options Options
+
+	// mutex guards quota, which is updated by the concurrent searches
+	mutex sync.Mutex
+	quota sources.Quota
+}
+
+// AssetType is the type of the assets HUNTER searches, the is_web parameter
+type AssetType int
+
+const (
+	// AssetWeb searches the web assets only
+	AssetWeb AssetType = 1
+	// AssetNonWeb searches the non web services only, e.g. ssh, databases, rdp
+	AssetNonWeb AssetType = 2
+	// AssetAll searches all the assets, it's the default
+	AssetAll AssetType = 3
+)
+
+// Options is the options of the HUNTER provider, set with cyberetrieve.WithProviderOptions
+type Options struct {
+	// AssetType is the type of the assets to search, AssetAll if zero
+	AssetType AssetType
+
+	// StatusCodes keeps the web assets of the http status codes only, e.g. 200, 401
+	StatusCodes []int
+
+	// PortFilter asks hunter to filter out the invalid port data
+	PortFilter bool
+
+	// QuotaFloor is the points to keep in the account, the search stops with sources.ErrQuotaFloor
+	// before a page which could take the remaining quota below it, a page costs up to a point per result.
+	// With no floor, the search stops once the quota is exhausted
+	QuotaFloor int
+}
+
+// Configure sets the HUNTER options, options is an Options or *Options
+func (p *Provider) Configure(options interface{}) error {
+	var o Options
+	switch v := options.(type) {
+	case Options:
+		o = v
+	case *Options:
+		o = *v
+	default:
+		return fmt.Errorf("%T is not hunter.Options", options)
+	}
+	if o.AssetType < 0 || o.AssetType > AssetAll {
+		return fmt.Errorf("unknown asset type %d", o.AssetType)
+	}
+	p.options = o
+	return nil
+}
+
+// Quota returns the quota of the account reported by the last search response
+func (p *Provider) Quota() sources.Quota {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.quota
+}
+
+// setQuota records the quota of a search response, the values hunter can't parse are ignored
+func (p *Provider) setQuota(result *HunterSearchResult) {
+	remaining, ok := parseQuota(result.Data.RestQuota)
+	if !ok {
+		return
+	}
+	consumed, _ := parseQuota(result.Data.ConsumeQuota)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.quota = sources.Quota{Remaining: remaining, Consumed: consumed, UpdatedAt: time.Now()}
+}
+
+// floorError returns the sources.ErrQuotaFloor error if fetching a page of pageSize results
+// could take the known quota below the floor, or nil
+func (p *Provider) floorError(pageSize int) error {
+	quota := p.Quota()
+	if !quota.Known() {
+		return nil
+	}
+	floor := p.options.QuotaFloor
+	if floor > 0 && quota.Remaining-pageSize >= floor || floor <= 0 && quota.Remaining > 0 {
+		return nil
+	}
+	return sources.NewProviderError(HUNTER, sources.ErrQuotaFloor,
+		fmt.Sprintf("%d points left, a page costs up to %d, floor is %d", quota.Remaining, pageSize, floor), nil)
 }
 
 // Name returns the name of the provider
@@ -26,56 +132,97 @@ func (p *Provider) Name() string {
 	return HUNTER
 }
 
+// Grammar returns the HUNTER grammar translator
+func (p *Provider) Grammar() *sources.Grammar {
+	return Grammar
+}
+
 // Auth checks if the provider is valid to use
-func (p *Provider) Auth(s *sources.Session) bool {
+func (p *Provider) Auth(ctx context.Context, s *sources.Session) (bool, error) {
 	client := sources.DefaultClient
-	if s.HunterKey == "" {
-		return false
+	key := s.Key(SESSION_KEY)
+	if key == "" {
+		return false, nil
 	}
-	resp, err := client.Get(AUTH_URL+s.HunterKey, nil)
+	resp, err := client.GetWithContext(ctx, AUTH_URL+key, nil)
 	if err != nil {
-		return false
+		return false, sources.RequestError(HUNTER, err)
+	}
+	if err = sources.AuthError(HUNTER, resp.StatusCode, ""); err != nil {
+		return false, err
+	}
+	// hunter reports errors with an http like code in the body
+	hunterSearchResult := &HunterSearchResult{}
+	if resp.Into(hunterSearchResult) == nil {
+		if err = sources.AuthError(HUNTER, hunterSearchResult.Code, hunterSearchResult.Message); err != nil {
+			return false, err
+		}
 	}
 	if !strings.Contains(resp.String(), `搜索内容不能为空`) {
-		return false
+		return false, nil
+	}
+	p.key = key
+	return true, nil
+}
+
+// PageSize returns the page size to fetch numberOfQuery results,
+// hunter can't fetch less than 10 results per page
+func (p *Provider) PageSize(numberOfQuery int) int {
+	pageSize := sources.DEFAULT_PAGE_SIZE
+	if numberOfQuery < pageSize {
+		pageSize = numberOfQuery
+	}
+	if numberOfQuery > sources.DEFAULT_PAGE_SIZE_MAX || numberOfQuery == -1 {
+		pageSize = sources.DEFAULT_PAGE_SIZE_MAX / 2
 	}
-	SEARCH_URL = AUTH_URL + s.HunterKey
-	return true
+
+	if numberOfQuery < minPageSize && numberOfQuery != -1 {
+		pageSize = minPageSize
+	}
+	return pageSize
 }
 
 // Search the result with provider
-func (p *Provider) Search(query *sources.Query) (chan *sources.Result, error) {
-	results := make(chan *sources.Result)
+func (p *Provider) Search(ctx context.Context, query *sources.Query) (*sources.Stream, error) {
+	stream := sources.NewStream()
 
 	go func() {
-		defer close(results)
+		var err error
+		defer func() { stream.Close(err) }()
 		numberOfResult := 0
-		pageSize := sources.DEFAULT_PAGE_SIZE
-		if query.NumberOfQuery < pageSize {
-			pageSize = query.NumberOfQuery
-		}
-		if query.NumberOfQuery > sources.DEFAULT_PAGE_SIZE_MAX || query.NumberOfQuery == -1 {
-			pageSize = sources.DEFAULT_PAGE_SIZE_MAX / 2
-		}
-
-		if query.NumberOfQuery < 10 && query.NumberOfQuery != -1 {
+		pageSize := p.PageSize(query.NumberOfQuery)
+		if query.NumberOfQuery < minPageSize && query.NumberOfQuery != -1 {
 			gologger.Warning().Label("Provider").
-				Msgf("%s query number can't below 10, set query number to 10\n", p.Name())
-			pageSize = 10
+				Msgf("%s query number can't below %d, set query number to %d\n", p.Name(), minPageSize, minPageSize)
 		}
 		pageNumber := 1
 
 		querySentence := query.Query
 		//If AutoGrammar is on, use transferred grammar
-		if query.HunterQuery != "" {
-			querySentence = query.HunterQuery
+		if native := query.Native(p.Name()); native != "" {
+			querySentence = native
 		}
 		gologger.Info().Msgf("Provider %s search grammar: %s \n", p.Name(), querySentence)
 
+		syntaxPrompt := ""
 		for {
-			queryFiled := NewHunterSearchFiled(querySentence, pageNumber, pageSize)
+			// the quota is shared with the other searches of the account, it's checked before each page
+			if err = p.floorError(pageSize); err != nil {
+				gologger.Warning().Label("Provider").
+					Msgf("%s search stopped: %s. You've found %d items\n", p.Name(), err, numberOfResult)
+				break
+			}
+
+			queryFiled := NewHunterSearchFiled(querySentence, pageNumber, pageSize, p.options)
 			pageNumber++
-			currentSearchResult, err := p.query(queryFiled, results)
+			var currentSearchResult *HunterSearchResult
+			currentSearchResult, err = p.query(ctx, queryFiled, query.IncludeRaw, stream.Results)
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				gologger.Info().Label("Provider").
+					Msgf("%s search cancelled. You've found %d items\n", p.Name(), numberOfResult)
+				break
+			}
 			if err != nil {
 				gologger.Error().
 					Label("Provider").
@@ -85,6 +232,13 @@ func (p *Provider) Search(query *sources.Query) (chan *sources.Result, error) {
 				break
 			}
 
+			// hunter prompts the same syntax issue on every page, it's warned once
+			if prompt := syntaxPromptOf(currentSearchResult); prompt != "" && prompt != syntaxPrompt {
+				syntaxPrompt = prompt
+				stream.Warn(fmt.Sprintf("query syntax: %s", prompt))
+				gologger.Warning().Label("Provider").Msgf("%s query syntax: %s\n", p.Name(), prompt)
+			}
+
 			if currentSearchResult == nil || len(currentSearchResult.Data.Arr) == 0 {
 				gologger.Info().Label("Provider").
 					Msgf("%s search done. You've found %d items\n", p.Name(), numberOfResult)
@@ -100,54 +254,175 @@ func (p *Provider) Search(query *sources.Query) (chan *sources.Result, error) {
 		}
 	}()
 
-	return results, nil
+	return stream, nil
 }
 
-func (p *Provider) query(queryFiled HunterSearchFiled, results chan *sources.Result) (*HunterSearchResult, error) {
-	searchUrl := fmt.Sprintf("%s%s", SEARCH_URL, hunterSearchTrans(queryFiled))
-	resp, err := sources.DefaultClient.Get(searchUrl, nil)
-	if err != nil || resp.StatusCode != 200 {
+func (p *Provider) query(ctx context.Context, queryFiled HunterSearchFiled, raw bool, results chan *sources.Result) (*HunterSearchResult, error) {
+	searchUrl := fmt.Sprintf("%s%s%s", SEARCH_URL, p.key, hunterSearchTrans(queryFiled))
+	resp, err := sources.DefaultClient.GetWithContext(ctx, searchUrl, nil)
+	if err != nil {
 		gologger.Debug().Msgf("%s Search Error: %s \n", p.Name(), err)
-		return nil, err
+		return nil, sources.RequestError(HUNTER, err)
 	}
 
 	hunterSearchResult := &HunterSearchResult{}
 	err = resp.Into(hunterSearchResult)
 	if err != nil {
 		gologger.Debug().Msgf("%s search result unmarshal error: %s \n", p.Name(), err)
-		return nil, err
+		if resp.StatusCode != 200 {
+			return nil, sources.ResponseError(HUNTER, resp.StatusCode, "")
+		}
+		return nil, sources.DecodeError(HUNTER, err)
+	}
+	// hunter reports errors with an http like code in the body
+	if hunterSearchResult.Code != 200 {
+		return nil, sources.ResponseError(HUNTER, hunterSearchResult.Code, hunterSearchResult.Message)
 	}
+	p.setQuota(hunterSearchResult)
 
-	for _, item := range hunterSearchResult.Data.Arr {
-		searchResult := &sources.Result{}
-		searchResult.IP = item.IP
-		searchResult.Port = item.Port
-		searchResult.URL = item.URL
-		searchResult.Domain = item.Domain
-		searchResult.ICPUnit = item.Company
-		searchResult.ICPLicence = item.Number
+	var rawItems []json.RawMessage
+	if raw {
+		rawItems = hunterRawItems(resp.Bytes())
+	}
+
+	for i, item := range hunterSearchResult.Data.Arr {
+		searchResult := newResult(item)
+		if i < len(rawItems) {
+			searchResult.Raw = rawItems[i]
+		}
 
-		results <- searchResult
+		select {
+		case results <- searchResult:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 
 	return hunterSearchResult, nil
 }
 
+// newResult maps a Hunter asset to a Result
+func newResult(item HunterAsset) *sources.Result {
+	searchResult := &sources.Result{}
+	searchResult.IP = item.IP
+	searchResult.Port = item.Port
+	searchResult.URL = item.URL
+	searchResult.Domain = item.Domain
+	// hunter has no host field, the host of the url is used like the host of the other providers
+	if u, err := url.Parse(item.URL); err == nil {
+		searchResult.Host = u.Host
+	}
+	searchResult.ICPUnit = item.Company
+	searchResult.ICPLicence = item.Number
+	searchResult.Title = item.WebTitle
+	searchResult.StatusCode = item.StatusCode
+	searchResult.Server = bannerServer(item.Banner)
+	searchResult.Protocol = item.Protocol
+	searchResult.Transport = item.BaseProtocol
+	for _, component := range item.Component {
+		if component.Name == "" {
+			continue
+		}
+		searchResult.Components = append(searchResult.Components, sources.Component{
+			Name:    component.Name,
+			Version: component.Version,
+		})
+	}
+	searchResult.OS = item.Os
+	searchResult.Banner = item.Banner
+	searchResult.Country = sources.NormalizeCountry(item.Country)
+	searchResult.Region = item.Province
+	searchResult.City = item.City
+	searchResult.Org = item.AsOrg
+	searchResult.ISP = item.Isp
+	searchResult.Timestamp = sources.ParseTime(item.UpdatedAt)
+	searchResult.Provider = HUNTER
+	return searchResult
+}
+
+// syntaxPromptOf returns the query syntax prompt of a search response, or empty
+func syntaxPromptOf(result *HunterSearchResult) string {
+	if result == nil {
+		return ""
+	}
+	return strings.TrimSpace(result.Data.SyntaxPrompt)
+}
+
+// parseQuota parses the points of a quota field, like 剩余积分：49930
+func parseQuota(field string) (int, bool) {
+	digits := strings.FieldsFunc(field, func(r rune) bool { return r < '0' || r > '9' })
+	if len(digits) == 0 {
+		return 0, false
+	}
+	points, err := strconv.Atoi(digits[len(digits)-1])
+	return points, err == nil
+}
+
+// bannerServer returns the Server header of an http banner, or empty
+func bannerServer(banner string) string {
+	for _, line := range strings.Split(banner, "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "server") {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// Grammar renders the neutral query AST into HUNTER search grammar
+var Grammar = &sources.Grammar{
+	Name:      HUNTER,
+	And:       " && ",
+	Or:        " || ",
+	Operators: sources.OpAnd | sources.OpOr | sources.OpNot,
+	Fields: map[string]sources.Field{
+		sources.FieldIP:         {Keyword: "ip"},
+		sources.FieldCIDR:       {Keyword: "ip"},
+		sources.FieldPort:       {Keyword: "ip.port", Numeric: true},
+		sources.FieldProtocol:   {Keyword: "protocol"},
+		sources.FieldCountry:    {Keyword: "ip.country", Transform: sources.CountryNameCN},
+		sources.FieldRegion:     {Keyword: "ip.province"},
+		sources.FieldCity:       {Keyword: "ip.city"},
+		sources.FieldASN:        {Keyword: "as.number", Numeric: true},
+		sources.FieldOrg:        {Keyword: "as.org"},
+		sources.FieldDomain:     {Keyword: "domain"},
+		sources.FieldSubdomain:  {Keyword: "domain.suffix"},
+		sources.FieldHeader:     {Keyword: "header"},
+		sources.FieldTitle:      {Keyword: "web.title"},
+		sources.FieldBody:       {Keyword: "web.body"},
+		sources.FieldServer:     {Keyword: "header.server"},
+		sources.FieldApp:        {Keyword: "app.name"},
+		sources.FieldStatusCode: {Keyword: "header.status_code", Numeric: true},
+		sources.FieldFavicon:    {Keyword: "web.icon"},
+		sources.FieldCert:       {Keyword: "cert"},
+		sources.FieldICP:        {Keyword: "icp.number"},
+		sources.FieldICPUnit:    {Keyword: "icp.name"},
+	},
+	Term:   parse2HunterKeywords,
+	Syntax: sources.SyntaxEqual,
+}
+
+// ToHunterGrammer translates the neutral query into HUNTER search grammar
 func ToHunterGrammer(s string) (string, error) {
-	keywords := strings.Split(s, ":")
-	keyword, search := keywords[0], keywords[1]
-	switch keyword {
-	case "ip":
-		return fmt.Sprintf(`ip="%s"`, search), nil
-	case "domain":
-		return fmt.Sprintf(`domain="%s"`, search), nil
-	case "header":
-		return fmt.Sprintf(`header="%s"`, search), nil
-	case "favicon":
-		return fmt.Sprintf(`web.icon="%s"`, search), nil
-	case "cert":
-		return fmt.Sprintf(`cert="%s"`, search), nil
-	default:
-		return "", errors.New("transfer to hunter grammar false")
+	return Grammar.Translate(s)
+}
+
+// FromHunterGrammar translates a HUNTER query back into the neutral query
+func FromHunterGrammar(s string) (string, error) {
+	node, err := Grammar.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return node.String(), nil
+}
+
+func parse2HunterKeywords(f sources.Field, t *sources.TermNode, negated bool) (string, error) {
+	var (
+		equalSymbol = "="
+	)
+
+	if negated {
+		equalSymbol = "!="
 	}
+	return fmt.Sprintf("%s%s%s", f.Keyword, equalSymbol, sources.Quote(t.Value)), nil
 }
@@ -0,0 +1,86 @@
+package hunter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+)
+
+func TestParseQuota(t *testing.T) {
+	tests := []struct {
+		field  string
+		want   int
+		wantOk bool
+	}{
+		{"剩余积分：49930", 49930, true},
+		{"消耗积分：10", 10, true},
+		{"剩余积分:0", 0, true},
+		{"49930", 49930, true},
+		{"", 0, false},
+		{"剩余积分：", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseQuota(tt.field)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("parseQuota(%q) = %d, %v, want %d, %v", tt.field, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+// newQuotaProvider returns a provider whose last response reported the remaining quota
+func newQuotaProvider(floor, remaining int) *Provider {
+	p := &Provider{options: Options{QuotaFloor: floor}}
+	result := &HunterSearchResult{}
+	result.Data.RestQuota = "剩余积分：" + strconv.Itoa(remaining)
+	result.Data.ConsumeQuota = "消耗积分：10"
+	p.setQuota(result)
+	return p
+}
+
+func TestFloorError(t *testing.T) {
+	tests := []struct {
+		name      string
+		floor     int
+		remaining int
+		pageSize  int
+		wantStop  bool
+	}{
+		{"above floor after the page", 100, 250, 100, false},
+		{"at floor after the page", 100, 200, 100, false},
+		{"below floor after the page", 100, 150, 100, true},
+		{"at floor", 100, 100, 10, true},
+		{"no floor", 0, 5, 10, false},
+		{"no floor exhausted", 0, 0, 10, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newQuotaProvider(tt.floor, tt.remaining).floorError(tt.pageSize)
+			if stop := errors.Is(err, sources.ErrQuotaFloor); stop != tt.wantStop {
+				t.Errorf("floorError(%d) = %v, want stop %v", tt.pageSize, err, tt.wantStop)
+			}
+		})
+	}
+
+	if err := (&Provider{options: Options{QuotaFloor: 100}}).floorError(10); err != nil {
+		t.Errorf("floorError() with an unknown quota = %v, want nil", err)
+	}
+}
+
+func TestSearchStopsAtFloor(t *testing.T) {
+	// the quota is checked before the first page, no request is sent
+	p := newQuotaProvider(100, 105)
+	stream, err := p.Search(context.Background(), &sources.Query{Query: `ip="1.1.1.1"`, NumberOfQuery: 10})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	found := 0
+	for range stream.Results {
+		found++
+	}
+	if found != 0 || !errors.Is(stream.Err(), sources.ErrQuotaFloor) {
+		t.Errorf("Search() = %d results, %v, want the quota floor error", found, stream.Err())
+	}
+}
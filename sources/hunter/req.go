@@ -3,7 +3,9 @@ package hunter
 import (
 	"encoding/base64"
 	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,15 +13,31 @@ type HunterSearchFiled struct {
 	search     string
 	page       int
 	pageSize   int
+	isWeb      AssetType
+	statusCode string
+	portFilter bool
 	start_time string
 	end_time   string
 }
 
-func NewHunterSearchFiled(search string, pageIndex, pageSize int) HunterSearchFiled {
+// NewHunterSearchFiled returns the search of the query page, with the filters of the options
+func NewHunterSearchFiled(search string, pageIndex, pageSize int, options Options) HunterSearchFiled {
+	statusCodes := make([]string, 0, len(options.StatusCodes))
+	for _, code := range options.StatusCodes {
+		statusCodes = append(statusCodes, strconv.Itoa(code))
+	}
+	isWeb := options.AssetType
+	if isWeb == 0 {
+		isWeb = AssetAll
+	}
+
 	return HunterSearchFiled{
 		search:     search,
 		page:       pageIndex,
 		pageSize:   pageSize,
+		isWeb:      isWeb,
+		statusCode: strings.Join(statusCodes, ","),
+		portFilter: options.PortFilter,
 		start_time: fmt.Sprintf("%s+00%%3A00%%3A00", strconv.Itoa(time.Now().Year()-1)+time.Now().Format("2006-01-02 03:04:05")[4:10]),
 		end_time:   fmt.Sprintf("%s+23%%3A59%%3A59", time.Now().Format("2006-01-02 03:04:05")[:10]),
 	}
@@ -27,12 +45,19 @@ func NewHunterSearchFiled(search string, pageIndex, pageSize int) HunterSearchFi
 
 func hunterSearchTrans(h HunterSearchFiled) string {
 	getParameter := fmt.Sprintf(
-		"&search=%s&page=%v&page_size=%v&is_web=3&start_time=%s&end_time=%s",
+		"&search=%s&page=%v&page_size=%v&is_web=%d&start_time=%s&end_time=%s",
 		base64.URLEncoding.EncodeToString([]byte(h.search)),
 		h.page,
 		h.pageSize,
+		h.isWeb,
 		h.start_time,
 		h.end_time,
 	)
+	if h.statusCode != "" {
+		getParameter += "&status_code=" + url.QueryEscape(h.statusCode)
+	}
+	if h.portFilter {
+		getParameter += "&port_filter=true"
+	}
 	return getParameter
 }
@@ -0,0 +1,31 @@
+package hunter
+
+import "testing"
+
+func TestHunterSearchTrans(t *testing.T) {
+	const times = "&start_time=2023-01-02+00%3A00%3A00&end_time=2024-01-02+23%3A59%3A59"
+	tests := []struct {
+		name    string
+		search  string
+		options Options
+		want    string
+	}{
+		{"default", `web.title="a"`, Options{}, "&search=d2ViLnRpdGxlPSJhIg==&page=2&page_size=100&is_web=3" + times},
+		{"web assets", `web.title="a"`, Options{AssetType: AssetWeb}, "&search=d2ViLnRpdGxlPSJhIg==&page=2&page_size=100&is_web=1" + times},
+		{"url safe base64", `web.body="<?>"`, Options{AssetType: AssetNonWeb},
+			"&search=d2ViLmJvZHk9Ijw_PiI=&page=2&page_size=100&is_web=2" + times},
+		{"status codes", `web.title="a"`, Options{StatusCodes: []int{200, 301}},
+			"&search=d2ViLnRpdGxlPSJhIg==&page=2&page_size=100&is_web=3" + times + "&status_code=200%2C301"},
+		{"port filter", `web.title="a"`, Options{PortFilter: true},
+			"&search=d2ViLnRpdGxlPSJhIg==&page=2&page_size=100&is_web=3" + times + "&port_filter=true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHunterSearchFiled(tt.search, 2, 100, tt.options)
+			h.start_time, h.end_time = "2023-01-02+00%3A00%3A00", "2024-01-02+23%3A59%3A59"
+			if got := hunterSearchTrans(h); got != tt.want {
+				t.Errorf("hunterSearchTrans() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
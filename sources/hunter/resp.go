@@ -1,42 +1,60 @@
 package hunter
 
+import "encoding/json"
+
 // HunterSearchResult Hunter query data interface return data structure
 type HunterSearchResult struct {
 	Code int `json:"code"`
 	Data struct {
-		AccountType string `json:"account_type"`
-		Total       int    `json:"total"`
-		Time        int    `json:"time"`
-		Arr         []struct {
-			IsRisk         string `json:"is_risk"`
-			URL            string `json:"url"`
-			IP             string `json:"ip"`
-			Port           int    `json:"port"`
-			WebTitle       string `json:"web_title"`
-			Domain         string `json:"domain"`
-			IsRiskProtocol string `json:"is_risk_protocol"`
-			Protocol       string `json:"protocol"`
-			BaseProtocol   string `json:"base_protocol"`
-			StatusCode     int    `json:"status_code"`
-			Component      []struct {
-				Name    string `json:"name"`
-				Version string `json:"version"`
-			} `json:"component"`
-			Os        string `json:"os"`
-			Company   string `json:"company"`
-			Number    string `json:"number"`
-			Country   string `json:"country"`
-			Province  string `json:"province"`
-			City      string `json:"city"`
-			UpdatedAt string `json:"updated_at"`
-			IsWeb     string `json:"is_web"`
-			AsOrg     string `json:"as_org"`
-			Isp       string `json:"isp"`
-			Banner    string `json:"banner"`
-		} `json:"arr"`
-		ConsumeQuota string `json:"consume_quota"`
-		RestQuota    string `json:"rest_quota"`
-		SyntaxPrompt string `json:"syntax_prompt"`
+		AccountType  string        `json:"account_type"`
+		Total        int           `json:"total"`
+		Time         int           `json:"time"`
+		Arr          []HunterAsset `json:"arr"`
+		ConsumeQuota string        `json:"consume_quota"`
+		RestQuota    string        `json:"rest_quota"`
+		SyntaxPrompt string        `json:"syntax_prompt"`
 	} `json:"data"`
 	Message string `json:"message"`
 }
+
+// HunterAsset is an asset item of the Hunter search data
+type HunterAsset struct {
+	IsRisk         string `json:"is_risk"`
+	URL            string `json:"url"`
+	IP             string `json:"ip"`
+	Port           int    `json:"port"`
+	WebTitle       string `json:"web_title"`
+	Domain         string `json:"domain"`
+	IsRiskProtocol string `json:"is_risk_protocol"`
+	Protocol       string `json:"protocol"`
+	BaseProtocol   string `json:"base_protocol"`
+	StatusCode     int    `json:"status_code"`
+	Component      []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"component"`
+	Os        string `json:"os"`
+	Company   string `json:"company"`
+	Number    string `json:"number"`
+	Country   string `json:"country"`
+	Province  string `json:"province"`
+	City      string `json:"city"`
+	UpdatedAt string `json:"updated_at"`
+	IsWeb     string `json:"is_web"`
+	AsOrg     string `json:"as_org"`
+	Isp       string `json:"isp"`
+	Banner    string `json:"banner"`
+}
+
+// hunterRawItems returns the original items of a search response body, or nil if it can't be decoded
+func hunterRawItems(body []byte) []json.RawMessage {
+	var raw struct {
+		Data struct {
+			Arr []json.RawMessage `json:"arr"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil
+	}
+	return raw.Data.Arr
+}
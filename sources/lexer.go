@@ -0,0 +1,208 @@
+package sources
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind uint8
+
+const (
+	tokEOF      tokenKind = iota
+	tokWord               // bare word, e.g. field name or unquoted value
+	tokString             // double quoted string, Value holds the unescaped content
+	tokColon              // :
+	tokAnd                // && or and
+	tokOr                 // || or or
+	tokNot                // ! or not
+	tokLParen             // (
+	tokRParen             // )
+	tokEqual              // =
+	tokNotEqual           // !=
+	tokExact              // ==
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokEOF:
+		return "end of query"
+	case tokWord:
+		return "word"
+	case tokString:
+		return "string"
+	case tokColon:
+		return `":"`
+	case tokAnd:
+		return `"&&"`
+	case tokOr:
+		return `"||"`
+	case tokNot:
+		return `"not"`
+	case tokLParen:
+		return `"("`
+	case tokRParen:
+		return `")"`
+	case tokEqual:
+		return `"="`
+	case tokNotEqual:
+		return `"!="`
+	case tokExact:
+		return `"=="`
+	default:
+		return "unknown token"
+	}
+}
+
+type token struct {
+	Kind  tokenKind
+	Value string
+	Pos   int // byte offset in the query
+}
+
+// SyntaxError is returned when a query can't be tokenized or parsed
+type SyntaxError struct {
+	Query string
+	Pos   int
+	Msg   string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+// lexer splits a query into tokens
+type lexer struct {
+	input  string
+	pos    int
+	syntax Syntax
+}
+
+// tokenize returns all tokens of the input, ending with a tokEOF token
+func tokenize(input string, syntax Syntax) ([]token, error) {
+	l := &lexer{input: input, syntax: syntax}
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.Kind == tokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+func (l *lexer) errorf(pos int, format string, args ...interface{}) error {
+	return &SyntaxError{Query: l.input, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.input) {
+		r, size := utf8.DecodeRuneInString(l.input[l.pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		l.pos += size
+	}
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{Kind: tokEOF, Pos: start}, nil
+	}
+
+	switch c := l.input[l.pos]; {
+	case c == '"':
+		return l.quoted()
+	case c == ':':
+		l.pos++
+		return token{Kind: tokColon, Value: ":", Pos: start}, nil
+	case c == '(':
+		l.pos++
+		return token{Kind: tokLParen, Value: "(", Pos: start}, nil
+	case c == ')':
+		l.pos++
+		return token{Kind: tokRParen, Value: ")", Pos: start}, nil
+	case l.syntax == SyntaxEqual && strings.HasPrefix(l.input[l.pos:], "!="):
+		l.pos += 2
+		return token{Kind: tokNotEqual, Value: "!=", Pos: start}, nil
+	case l.syntax == SyntaxEqual && strings.HasPrefix(l.input[l.pos:], "=="):
+		l.pos += 2
+		return token{Kind: tokExact, Value: "==", Pos: start}, nil
+	case l.syntax == SyntaxEqual && c == '=':
+		l.pos++
+		return token{Kind: tokEqual, Value: "=", Pos: start}, nil
+	case c == '!':
+		l.pos++
+		return token{Kind: tokNot, Value: "!", Pos: start}, nil
+	case strings.HasPrefix(l.input[l.pos:], "&&"):
+		l.pos += 2
+		return token{Kind: tokAnd, Value: "&&", Pos: start}, nil
+	case strings.HasPrefix(l.input[l.pos:], "||"):
+		l.pos += 2
+		return token{Kind: tokOr, Value: "||", Pos: start}, nil
+	case c == '&' || c == '|':
+		return token{}, l.errorf(start, "unexpected %q, did you mean %q", c, strings.Repeat(string(c), 2))
+	}
+
+	// values are decoded by rune, a byte of a multibyte character is never a separator
+	for l.pos < len(l.input) {
+		r, size := utf8.DecodeRuneInString(l.input[l.pos:])
+		if !isWordRune(r) || (l.syntax == SyntaxEqual && r == '=') {
+			break
+		}
+		l.pos += size
+	}
+	word := l.input[start:l.pos]
+	if l.syntax == SyntaxEqual {
+		// and, or, not are plain words in the equal syntax
+		return token{Kind: tokWord, Value: word, Pos: start}, nil
+	}
+	switch strings.ToLower(word) {
+	case "and":
+		return token{Kind: tokAnd, Value: word, Pos: start}, nil
+	case "or":
+		return token{Kind: tokOr, Value: word, Pos: start}, nil
+	case "not":
+		return token{Kind: tokNot, Value: word, Pos: start}, nil
+	}
+	return token{Kind: tokWord, Value: word, Pos: start}, nil
+}
+
+// quoted reads a double quoted string, a backslash escapes the following character
+func (l *lexer) quoted() (token, error) {
+	start := l.pos
+	l.pos++ // skip the opening quote
+
+	var sb strings.Builder
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch c {
+		case '\\':
+			if l.pos+1 >= len(l.input) {
+				return token{}, l.errorf(l.pos, "unfinished escape sequence")
+			}
+			sb.WriteByte(l.input[l.pos+1])
+			l.pos += 2
+		case '"':
+			l.pos++
+			return token{Kind: tokString, Value: sb.String(), Pos: start}, nil
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, l.errorf(start, "unterminated quoted string")
+}
+
+func isWordRune(r rune) bool {
+	if unicode.IsSpace(r) {
+		return false
+	}
+	switch r {
+	case '"', ':', '(', ')', '&', '|', '!':
+		return false
+	}
+	return true
+}
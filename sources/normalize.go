@@ -0,0 +1,87 @@
+package sources
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// defaultPorts is the default port of each url scheme
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL returns the url in a canonical form to compare urls, the scheme is http when missing,
+// the scheme and host are lowercase, the default port, the trailing slash and the fragment are removed.
+// e.g. HTTPS://Example.com:443/a/ to https://example.com/a
+func NormalizeURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return strings.ToLower(raw)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = normalizeHostPort(u.Hostname(), u.Port(), u.Scheme)
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+// NormalizeHost returns the host of a host, host:port or url in a canonical form, lowercase and
+// without the default port of the scheme, e.g. https://Example.com:443/a to example.com
+func NormalizeHost(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return strings.ToLower(raw)
+	}
+	return normalizeHostPort(u.Hostname(), u.Port(), strings.ToLower(u.Scheme))
+}
+
+// normalizeHostPort joins the lowercase host with the port, unless it's the default port of the scheme
+func normalizeHostPort(host, port, scheme string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if port == "" || port == defaultPorts[scheme] {
+		if strings.Contains(host, ":") { // ipv6
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// NormalizeCountry returns the ISO 3166-1 alpha-2 code of the first known country of the values,
+// which are codes, english or chinese names, e.g. China or 中国 to CN.
+// The first non empty value is returned as it is when no country is known
+func NormalizeCountry(values ...string) string {
+	raw := ""
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if c, err := lookupCountry(value); err == nil {
+			return c.Code
+		}
+		if raw == "" {
+			raw = value
+		}
+	}
+	return raw
+}
@@ -0,0 +1,68 @@
+package sources
+
+import "testing"
+
+func TestNormalizeCountry(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{[]string{"CN"}, "CN"},
+		{[]string{"China"}, "CN"},
+		{[]string{"中国"}, "CN"},
+		{[]string{" united states "}, "US"},
+		{[]string{"", "日本"}, "JP"},
+		{[]string{"Atlantis", "中国"}, "CN"},
+		{[]string{"Atlantis", "亚特兰蒂斯"}, "Atlantis"},
+		{[]string{""}, ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeCountry(tt.values...); got != tt.want {
+			t.Errorf("NormalizeCountry(%q) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"Example.com/", "http://example.com"},
+		{"HTTPS://Example.com:443/a/#top", "https://example.com/a"},
+		{"https://example.com:8443", "https://example.com:8443"},
+		{"https://example.com:80/", "https://example.com:80"},
+		{"http://Example.com./", "http://example.com"},
+		{"http://[::1]:80/", "http://[::1]"},
+		{"https://[2001:db8::1]:8443/", "https://[2001:db8::1]:8443"},
+		{"http://example.com/a?q=1", "http://example.com/a?q=1"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeURL(tt.raw); got != tt.want {
+			t.Errorf("NormalizeURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"Example.com", "example.com"},
+		{"Example.com:80", "example.com"},
+		{"1.1.1.1:8080", "1.1.1.1:8080"},
+		{"https://Example.com:443/a", "example.com"},
+		{"https://example.com:8443/a", "example.com:8443"},
+		{"example.com.", "example.com"},
+		{"[::1]:80", "[::1]"},
+		{"https://[2001:db8::1]:8443/", "[2001:db8::1]:8443"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeHost(tt.raw); got != tt.want {
+			t.Errorf("NormalizeHost(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package sources
+
+import (
+	"strings"
+)
+
+// ParseQuery parses a neutral query, e.g. title:"login" && not domain:"",
+// into the query AST.
+//
+// Grammar:
+//
+//	expr    := and { ("||" | "or") and }
+//	and     := unary { ("&&" | "and") unary }
+//	unary   := ("!" | "not") unary | primary
+//	primary := "(" expr ")" | field ":" value
+//	value   := quoted string | bare word
+func ParseQuery(query string) (Node, error) {
+	return parse(query, nil)
+}
+
+// parse parses a neutral query, or the native query of grammar when it's not nil
+func parse(query string, grammar *Grammar) (Node, error) {
+	syntax := SyntaxColon
+	if grammar != nil {
+		syntax = grammar.Syntax
+	}
+	tokens, err := tokenize(query, syntax)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{query: query, tokens: tokens, grammar: grammar}
+	if p.peek().Kind == tokEOF {
+		return nil, p.errorf(p.peek(), "empty query")
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.Kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected "+describe(tok))
+	}
+	return node, nil
+}
+
+type parser struct {
+	query   string
+	tokens  []token
+	pos     int
+	grammar *Grammar // nil when parsing the neutral query
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok token, msg string) error {
+	return &SyntaxError{Query: p.query, Pos: tok.Pos, Msg: msg}
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().Kind == tokOr {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Op: OpOr, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().Kind == tokAnd {
+		p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryNode{Op: OpAnd, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().Kind == tokNot {
+		p.advance()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotNode{Expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	tok := p.advance()
+	switch tok.Kind {
+	case tokLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.advance(); closing.Kind != tokRParen {
+			return nil, p.errorf(closing, "expected \")\" but got "+describe(closing))
+		}
+		return expr, nil
+	case tokWord:
+		return p.parseTerm(tok)
+	default:
+		return nil, p.errorf(tok, "expected field or \"(\" but got "+describe(tok))
+	}
+}
+
+func (p *parser) parseTerm(field token) (Node, error) {
+	comparison := p.advance()
+	switch {
+	case p.grammar == nil || p.grammar.Syntax == SyntaxColon:
+		if comparison.Kind != tokColon {
+			return nil, p.errorf(comparison, "expected \":\" after field "+field.Value+" but got "+describe(comparison))
+		}
+	case comparison.Kind == tokExact:
+		return nil, &UntranslatableError{Provider: p.grammar.Name, Native: `exact match "=="`}
+	case comparison.Kind != tokEqual && comparison.Kind != tokNotEqual:
+		return nil, p.errorf(comparison, "expected \"=\" or \"!=\" after field "+field.Value+" but got "+describe(comparison))
+	}
+
+	value := p.advance()
+	if isKeyword(value) {
+		// e.g. title:not, the keyword is the search value here
+		value.Kind = tokWord
+	}
+	if value.Kind != tokString && value.Kind != tokWord {
+		return nil, p.errorf(value, "expected value of field "+field.Value+" but got "+describe(value))
+	}
+	if p.grammar == nil {
+		return &TermNode{Field: strings.ToLower(field.Value), Value: value.Value}, nil
+	}
+	if value.Kind == tokWord && strings.ContainsAny(value.Value[:1], "[{") {
+		return nil, &UntranslatableError{Provider: p.grammar.Name, Native: "range query on field " + field.Value}
+	}
+
+	node, err := p.grammar.neutral(field.Value, value.Value)
+	if err != nil {
+		return nil, err
+	}
+	if comparison.Kind == tokNotEqual {
+		node = &NotNode{Expr: node}
+	}
+	return node, nil
+}
+
+// isKeyword reports whether tok is one of the word operators and, or, not
+func isKeyword(tok token) bool {
+	switch tok.Kind {
+	case tokAnd, tokOr, tokNot:
+		// the operators are ascii, a word operator starts with a letter
+		return tok.Value != "" && isWordRune(rune(tok.Value[0]))
+	}
+	return false
+}
+
+func describe(tok token) string {
+	if tok.Kind == tokWord || tok.Kind == tokString {
+		return tok.Kind.String() + " " + Quote(tok.Value)
+	}
+	return tok.Kind.String()
+}
@@ -0,0 +1,133 @@
+package sources_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/N0el4kLs/cyberetrieve/sources"
+	"github.com/N0el4kLs/cyberetrieve/sources/fofa"
+	"github.com/N0el4kLs/cyberetrieve/sources/hunter"
+	"github.com/N0el4kLs/cyberetrieve/sources/quake"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"quoted", `title:"login"`, `title:"login"`},
+		{"unquoted", `port:443`, `port:"443"`},
+		{"multibyte org", `org:北京公司`, `org:"北京公司"`},
+		{"multibyte icp unit", `icp_unit:北京百度网讯科技有限公司`, `icp_unit:"北京百度网讯科技有限公司"`},
+		{"multibyte and", `title:公司 && icp:京ICP证030173号`, `title:"公司" && icp:"京ICP证030173号"`},
+		{"multibyte not", `not city:上海 || country:中国`, `not city:"上海" || country:"中国"`},
+		{"unicode space", "title:公司　&& port:80", `title:"公司" && port:"80"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := sources.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) error = %v", tt.query, err)
+			}
+			if got := node.String(); got != tt.want {
+				t.Errorf("ParseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryError(t *testing.T) {
+	tests := []string{
+		`title:"login`,
+		`title:login &`,
+		`(port:80`,
+		`title:`,
+	}
+	for _, query := range tests {
+		if _, err := sources.ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) error = nil, want a syntax error", query)
+		}
+	}
+}
+
+func TestGrammarParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		grammar *sources.Grammar
+		native  string
+		want    string
+	}{
+		{"fofa multibyte", fofa.Grammar, `title=公司`, `title:"公司"`},
+		{"fofa multibyte and", fofa.Grammar, `title=公司 && port=80`, `title:"公司" && port:"80"`},
+		{"hunter multibyte", hunter.Grammar, `icp.name=北京百度网讯科技有限公司`, `icp_unit:"北京百度网讯科技有限公司"`},
+		{"hunter multibyte not", hunter.Grammar, `web.title!=公司`, `not title:"公司"`},
+		{"fofa not equal", fofa.Grammar, `title="a" && port!="80"`, `title:"a" && not port:"80"`},
+		{"fofa group", fofa.Grammar, `(title="a" || body="b") && port="80"`, `(title:"a" || body:"b") && port:"80"`},
+		{"fofa words are values", fofa.Grammar, `title=and || title=not`, `title:"and" || title:"not"`},
+		{"quake not", quake.Grammar, `title:"a" AND NOT port:80`, `title:"a" && not port:"80"`},
+		{"quake is_domain", quake.Grammar, `is_domain: true`, `not domain:""`},
+		{"quake not is_domain", quake.Grammar, `is_domain:false && port:80`, `domain:"" && port:"80"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := tt.grammar.Parse(tt.native)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.native, err)
+			}
+			if got := node.String(); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.native, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrammarParseUntranslatable(t *testing.T) {
+	tests := []struct {
+		name    string
+		grammar *sources.Grammar
+		native  string
+		want    string
+	}{
+		{"fofa exact", fofa.Grammar, `title=="a"`, `FOFA exact match "==" has no neutral equivalent`},
+		{"hunter exact", hunter.Grammar, `web.title=="a" && ip.port="80"`, `HUNTER exact match "==" has no neutral equivalent`},
+		{"quake range", quake.Grammar, `port:[80 TO 443]`, `QUAKE range query on field port has no neutral equivalent`},
+		{"quake exclusive range", quake.Grammar, `title:"a" AND port: {80 TO 443}`, `QUAKE range query on field port has no neutral equivalent`},
+		{"unknown field", fofa.Grammar, `fid="abc"`, `FOFA field fid has no neutral equivalent`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.grammar.Parse(tt.native)
+			if !errors.Is(err, sources.ErrUntranslatable) {
+				t.Fatalf("Parse(%q) error = %v, want ErrUntranslatable", tt.native, err)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Parse(%q) error = %s, want %s", tt.native, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrammarTranslate(t *testing.T) {
+	tests := []struct {
+		name    string
+		grammar *sources.Grammar
+		query   string
+		want    string
+	}{
+		{"fofa", fofa.Grammar, `org:北京公司 && port:443`, `org="北京公司" && port="443"`},
+		{"hunter", hunter.Grammar, `icp_unit:北京百度网讯科技有限公司`, `icp.name="北京百度网讯科技有限公司"`},
+		{"quake is_domain", quake.Grammar, `not domain:""`, `is_domain: true`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.grammar.Translate(tt.query)
+			if err != nil {
+				t.Fatalf("Translate(%q) error = %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("Translate(%q) = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,8 @@
 package quake
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -14,15 +15,21 @@ const (
 	QUAKE      = "QUAKE"
 	AUTH_URL   = "https://quake.360.cn/api/v3/user/info"
 	SEARCH_URL = "https://quake.360.cn/api/v3/search/quake_service"
-)
 
-var (
-	quakeHeader = map[string]string{
-		"X-QuakeToken": "",
-	}
+	// SESSION_KEY is the key of the QUAKE token in sources.Session.Keys
+	SESSION_KEY = "quake"
 )
 
+func init() {
+	sources.RegisterProvider(sources.ProviderInfo{
+		Name: QUAKE,
+		New:  func() sources.Provider { return &Provider{} },
+	})
+}
+
 type Provider struct {
+	// token is the QUAKE API token, it's set by a successful Auth
+	token string
 }
 
 // Name returns the name of the provider
@@ -30,54 +37,77 @@ func (p *Provider) Name() string {
 	return QUAKE
 }
 
+// Grammar returns the QUAKE grammar translator
+func (p *Provider) Grammar() *sources.Grammar {
+	return Grammar
+}
+
 // Auth checks if the provider is valid to use
-func (p *Provider) Auth(s *sources.Session) bool {
+func (p *Provider) Auth(ctx context.Context, s *sources.Session) (bool, error) {
 	client := sources.DefaultClient
-	if s.QuakeToken == "" {
-		return false
+	token := s.Key(SESSION_KEY)
+	if token == "" {
+		return false, nil
 	}
-	quakeHeader["X-QuakeToken"] = s.QuakeToken
-	resp, err := client.Get(AUTH_URL, quakeHeader)
+	quakeHeader := map[string]string{
+		"X-QuakeToken": token,
+	}
+	resp, err := client.GetWithContext(ctx, AUTH_URL, quakeHeader)
 	if err != nil {
-		return false
+		return false, sources.RequestError(QUAKE, err)
+	}
+	if err = sources.AuthError(QUAKE, resp.StatusCode, ""); err != nil {
+		return false, err
 	}
 	//fmt.Printf("Quake Auth Resp: %s \n", resp.String())
 	if !strings.Contains(resp.String(), `"message":"Successful."`) {
-		return false
+		return false, nil
 	}
-	return true
+	p.token = token
+	return true, nil
+}
+
+// PageSize returns the page size to fetch numberOfQuery results
+func (p *Provider) PageSize(numberOfQuery int) int {
+	pageSize := sources.DEFAULT_PAGE_SIZE
+	if numberOfQuery < pageSize {
+		pageSize = numberOfQuery
+	}
+	if numberOfQuery > sources.DEFAULT_PAGE_SIZE_MAX || numberOfQuery == -1 {
+		pageSize = sources.DEFAULT_PAGE_SIZE_MAX
+	}
+	return pageSize
 }
 
 // Search the result with provider
-func (p *Provider) Search(query *sources.Query) (chan *sources.Result, error) {
-	results := make(chan *sources.Result)
+func (p *Provider) Search(ctx context.Context, query *sources.Query) (*sources.Stream, error) {
+	stream := sources.NewStream()
 
 	go func() {
-		defer close(results)
+		var err error
+		defer func() { stream.Close(err) }()
 		numberOfResult := 0
-		pageSize := sources.DEFAULT_PAGE_SIZE
-		if query.NumberOfQuery < pageSize {
-			pageSize = query.NumberOfQuery
-		}
-		if query.NumberOfQuery > sources.DEFAULT_PAGE_SIZE_MAX || query.NumberOfQuery == -1 {
-			pageSize = sources.DEFAULT_PAGE_SIZE_MAX
-		}
+		pageSize := p.PageSize(query.NumberOfQuery)
 
 		querySentence := query.Query
 		// If AutoGrammar is on, use transferred grammar
-		if query.QuakeQuery != "" {
-			querySentence = query.QuakeQuery
+		if native := query.Native(p.Name()); native != "" {
+			querySentence = native
 		}
 		gologger.Info().Msgf("Provider %s search grammar: %s \n", p.Name(), querySentence)
 		for {
 			queryFiled := NewQuakeSearchFiled(querySentence, numberOfResult, pageSize)
-			currentSearchResult, err := p.query(queryFiled, results)
-			if err != nil { // todo need refactor error handle
-				gologger.Error().
-					Label("Provider").
-					Msgf("Quake search error: %s\n", err)
+			var currentSearchResult *QuakeSearchResult
+			currentSearchResult, err = p.query(ctx, queryFiled, query.IncludeRaw, stream.Results)
+			if ctx.Err() != nil {
+				err = ctx.Err()
 				gologger.Info().Label("Provider").
-					Msgf("%s search done. You've found %d items\n", p.Name(), numberOfResult)
+					Msgf("%s search cancelled. You've found %d items\n", p.Name(), numberOfResult)
+				break
+			}
+			if err != nil {
+				gologger.Error().Label("Provider").
+					Msgf("%s search error: %s. You've found %d items\n", p.Name(), err, numberOfResult)
 				break
 			}
 
@@ -97,18 +127,18 @@ func (p *Provider) Search(query *sources.Query) (chan *sources.Result, error) {
 		}
 	}()
 
-	return results, nil
+	return stream, nil
 }
 
-func (p *Provider) query(queryFiled *QuakeSearchFiled, results chan *sources.Result) (*QuakeSearchResult, error) {
+func (p *Provider) query(ctx context.Context, queryFiled *QuakeSearchFiled, raw bool, results chan *sources.Result) (*QuakeSearchResult, error) {
 	header := map[string]string{
-		"X-QuakeToken": quakeHeader["X-QuakeToken"],
+		"X-QuakeToken": p.token,
 		"Content-Type": "application/json",
 	}
-	resp, err := sources.DefaultClient.Post(SEARCH_URL, header, queryFiled)
+	resp, err := sources.DefaultClient.PostWithContext(ctx, SEARCH_URL, header, queryFiled)
 	if err != nil {
 		gologger.Debug().Msgf("Quake Search Error: %s \n", err)
-		return nil, err
+		return nil, sources.RequestError(QUAKE, err)
 	}
 
 	quakeSearchResults := NewQuakeSearchResult()
@@ -116,12 +146,21 @@ func (p *Provider) query(queryFiled *QuakeSearchFiled, results chan *sources.Res
 	//gologger.Debug().Msgf("Quake Search Result: %#v \n", quakeSearchResults)
 	if err != nil {
 		gologger.Debug().Msgf("Quake search result unmarshal error: %s \n", err)
-		return nil, err
+		if resp.StatusCode != 200 {
+			return nil, sources.ResponseError(QUAKE, resp.StatusCode, "")
+		}
+		return nil, sources.DecodeError(QUAKE, err)
 	}
+	// quota exhaustion and the other errors come as a message, with no data
 	if !strings.Contains(quakeSearchResults.Message, "Successful") {
-		return nil, errors.New(quakeSearchResults.Message)
+		return nil, sources.ResponseError(QUAKE, resp.StatusCode, quakeSearchResults.Message)
+	}
+	var rawItems []json.RawMessage
+	if raw {
+		rawItems = quakeRawItems(resp.Bytes())
 	}
-	for _, item := range quakeSearchResults.Data {
+
+	for i, item := range quakeSearchResults.Data {
 		searchResult := &sources.Result{}
 
 		searchResult.IP = item.IP
@@ -142,20 +181,83 @@ func (p *Provider) query(queryFiled *QuakeSearchFiled, results chan *sources.Res
 				searchResult.URL = fmt.Sprintf("http://%s:%d", d, searchResult.Port)
 			}
 		}
-		// Todo more effective way to get icp info
-		if len(item.Service.Http.Icp) > 0 {
-			searchResult.ICPUnit = item.Service.Http.Icp["main_licence"].(map[string]interface{})["unit"].(string)
-			searchResult.ICPLicence = item.Service.Http.Icp["main_licence"].(map[string]interface{})["licence"].(string)
+		icp, err := item.ICP()
+		if err != nil {
+			gologger.Debug().Msgf("Quake icp of %s:%d unmarshal error: %s \n", item.IP, item.Port, err)
+		}
+		searchResult.ICPUnit = icp.MainLicence.Unit
+		searchResult.ICPLicence = firstNonEmpty(icp.MainLicence.Licence, icp.Licence)
+
+		searchResult.Title = item.Service.Http.Title
+		searchResult.StatusCode = item.Service.Http.StatusCode
+		searchResult.Server = item.Service.Http.Server
+		searchResult.Protocol = item.Service.Name
+		searchResult.Transport = item.Transport
+		searchResult.Banner = item.Service.Response
+		searchResult.Components = components(item)
+		searchResult.Cert = certificate(item.Service.TLS.HandshakeLog.ServerCertificates.Certificate.Parsed)
+		searchResult.OS = strings.TrimSpace(item.OsName + " " + item.OsVersion)
+		searchResult.Country = sources.NormalizeCountry(item.Location.CountryEN, item.Location.CountryCN)
+		searchResult.Region = firstNonEmpty(item.Location.ProvinceEN, item.Location.ProvinceCN)
+		searchResult.City = firstNonEmpty(item.Location.CityEN, item.Location.CityCN)
+		searchResult.ISP = item.Location.Isp
+		searchResult.ASN = item.Asn
+		searchResult.Org = firstNonEmpty(item.Org, item.Location.Owner)
+		searchResult.Timestamp = sources.ParseTime(item.Time)
+		searchResult.Provider = QUAKE
+		if i < len(rawItems) {
+			searchResult.Raw = rawItems[i]
 		}
 
 		gologger.Debug().Msgf("%#v \n", searchResult)
 
-		results <- searchResult
+		select {
+		case results <- searchResult:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 
 	return quakeSearchResults, nil
 }
 
+// components returns the fingerprinted products of the service,
+// the product of the service itself is used when quake gives no component
+func components(item QuakeService) []sources.Component {
+	var components []sources.Component
+	for _, component := range item.Components {
+		name := firstNonEmpty(component.ProductNameEN, component.ProductNameCN)
+		if name == "" {
+			continue
+		}
+		components = append(components, sources.Component{Name: name, Version: component.Version})
+	}
+	if len(components) == 0 && item.Service.Product != "" {
+		components = append(components, sources.Component{Name: item.Service.Product, Version: item.Service.Version})
+	}
+	return components
+}
+
+// certificate maps the parsed tls certificate of a service
+func certificate(cert QuakeCertificate) sources.Certificate {
+	return sources.Certificate{
+		Subject:   cert.SubjectDN,
+		Issuer:    cert.IssuerDN,
+		SANs:      cert.Extensions.SubjectAltName.DNSNames,
+		NotBefore: sources.ParseTime(cert.Validity.Start),
+		NotAfter:  sources.ParseTime(cert.Validity.End),
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
 // If number of result is more than number of query, return true
 func isOverSize(numberOfResult, numberOfQuery int, currentSearchResult *QuakeSearchResult) bool {
 	var overSize = false
@@ -171,75 +273,87 @@ func isOverSize(numberOfResult, numberOfQuery int, currentSearchResult *QuakeSea
 	return overSize
 }
 
-func ToQuakeGrammar(s string) (string, error) {
-	var (
-		query      string
-		subQueries []string
-	)
-	if strings.Contains(s, "&&") {
-		subQueries = strings.Split(s, "&&")
-	} else {
-		subQueries = append(subQueries, s)
-	}
+// Grammar renders the neutral query AST into QUAKE search grammar
+var Grammar = &sources.Grammar{
+	Name:      QUAKE,
+	And:       " AND ",
+	Or:        " OR ",
+	Not:       quakeNot,
+	Operators: sources.OpAnd | sources.OpOr | sources.OpNot,
+	Fields: map[string]sources.Field{
+		sources.FieldIP:         {Keyword: "ip"},
+		sources.FieldCIDR:       {Keyword: "ip"},
+		sources.FieldPort:       {Keyword: "port", Numeric: true},
+		sources.FieldProtocol:   {Keyword: "service"},
+		sources.FieldCountry:    {Keyword: "country", Transform: sources.CountryName},
+		sources.FieldRegion:     {Keyword: "province"},
+		sources.FieldCity:       {Keyword: "city"},
+		sources.FieldASN:        {Keyword: "asn", Numeric: true},
+		sources.FieldOrg:        {Keyword: "org"},
+		sources.FieldDomain:     {Keyword: "domain"},
+		sources.FieldHeader:     {Keyword: "headers"},
+		sources.FieldTitle:      {Keyword: "title"},
+		sources.FieldBody:       {Keyword: "body"},
+		sources.FieldServer:     {Keyword: "server"},
+		sources.FieldApp:        {Keyword: "app"},
+		sources.FieldStatusCode: {Keyword: "status_code", Numeric: true},
+		sources.FieldFavicon:    {Keyword: "favicon"},
+		sources.FieldCert:       {Keyword: "cert"},
+		sources.FieldICP:        {Keyword: "icp"},
+		sources.FieldICPUnit:    {Keyword: "icp_keywords"},
+	},
+	Term:   parse2QuakeKeywords,
+	Syntax: sources.SyntaxColon,
+	Native: parseQuakeNative,
+}
 
-	for _, q := range subQueries {
-		if st, err := parse2QuakeKeywords(strings.TrimSpace(q)); err != nil {
-			return "", err
-		} else {
-			query += st + " AND "
-		}
-	}
+// ToQuakeGrammar translates the neutral query into QUAKE search grammar
+func ToQuakeGrammar(s string) (string, error) {
+	return Grammar.Translate(s)
+}
 
-	// handle the latest suffix
-	if strings.HasSuffix(query, "AND ") {
-		query = query[0 : len(query)-5]
+// FromQuakeGrammar translates a QUAKE query back into the neutral query
+func FromQuakeGrammar(s string) (string, error) {
+	node, err := Grammar.Parse(s)
+	if err != nil {
+		return "", err
 	}
-	return query, nil
+	return node.String(), nil
 }
 
-func parse2QuakeKeywords(s string) (string, error) {
+func parse2QuakeKeywords(f sources.Field, t *sources.TermNode, negated bool) (string, error) {
 	var (
-		notCondition bool
+		notCondition = negated
 		query        string
-		err          error
 	)
 
-	if strings.HasPrefix(strings.ToLower(s), "not ") {
-		notCondition = true
-		s = s[4:]
-	}
-	keywords := strings.Split(s, ":")
-	keyword, search := keywords[0], keywords[1]
-	switch keyword {
-	case "ip":
-		query = fmt.Sprintf("ip: %s", search)
-	case "domain":
-		if notCondition && search == `""` {
-			query = "is_domain: true"
-			notCondition = false
-		} else {
-			query = fmt.Sprintf("domain: %s", search)
-		}
-	case "header":
-		query = fmt.Sprintf("headers: %s", search)
-	case "favicon":
-		query = fmt.Sprintf("favicon: %s", search)
-	case "cert":
-		query = fmt.Sprintf("cert: %s", search)
-	case "title":
-		query = fmt.Sprintf("title: %s", search)
-	case "body":
-		query = fmt.Sprintf("body: %s", search)
-	default:
-		query = ""
-		err = errors.New("transfer to QUAKE grammar false")
-	}
-	if err != nil {
-		return query, err
+	if t.Field == sources.FieldDomain && notCondition && t.Value == "" {
+		query = "is_domain: true"
+		notCondition = false
+	} else if f.Numeric {
+		query = fmt.Sprintf("%s: %s", f.Keyword, t.Value)
+	} else {
+		query = fmt.Sprintf("%s: %s", f.Keyword, sources.Quote(t.Value))
 	}
 
 	if notCondition {
-		query = fmt.Sprintf("(NOT %s)", query)
+		query = quakeNot(query)
 	}
 	return query, nil
 }
+
+func quakeNot(expr string) string {
+	return fmt.Sprintf("(NOT %s)", expr)
+}
+
+// parseQuakeNative parses is_domain: true back into not domain:""
+func parseQuakeNative(keyword, value string) sources.Node {
+	if keyword != "is_domain" {
+		return nil
+	}
+	node := &sources.TermNode{Field: sources.FieldDomain, Value: ""}
+	if strings.EqualFold(value, "true") {
+		return &sources.NotNode{Expr: node}
+	}
+	return node
+}
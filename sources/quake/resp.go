@@ -1,37 +1,13 @@
 package quake
 
+import "encoding/json"
+
 // QuakeSearchResult Quake service data interface return data structure
 type QuakeSearchResult struct {
-	Code    interface{} `json:"code,omitempty"`
-	Message string      `json:"message,omitempty"`
-	Data    []struct {
-		Service struct {
-			Http struct {
-				Host            string                 `json:"host"`
-				Title           string                 `json:"title"`
-				MetaKeywords    string                 `json:"meta_keywords"`
-				XPoweredBy      string                 `json:"x_powered_by"`
-				HttpLoadUrl     []string               `json:"http_load_url"`
-				Robots          string                 `json:"robots"`
-				SitemapHash     string                 `json:"sitemap_hash"`
-				Server          string                 `json:"server"`
-				Body            string                 `json:"body"`
-				RobotsHash      string                 `json:"robots_hash"`
-				Sitemap         string                 `json:"sitemap"`
-				Path            string                 `json:"path"`
-				SecurityText    string                 `json:"security_text"`
-				StatusCode      int                    `json:"status_code"`
-				ResponseHeaders string                 `json:"response_headers"`
-				Icp             map[string]interface{} `json:"icp"` // Todo more effective way to get icp info
-			} `json:"http,omitempty"`
-		} `json:"service,omitempty"`
-		Port     int    `json:"port"`
-		Asn      int    `json:"asn"`
-		IP       string `json:"ip"`
-		Hostname string `json:"hostname"`
-		Domain   string `json:"domain"`
-	} `json:"data,omitempty"`
-	Meta struct {
+	Code    interface{}    `json:"code,omitempty"`
+	Message string         `json:"message,omitempty"`
+	Data    []QuakeService `json:"data,omitempty"`
+	Meta    struct {
 		Pagination struct {
 			Count     int `json:"count"`
 			PageIndex int `json:"page_index"`
@@ -41,7 +17,130 @@ type QuakeSearchResult struct {
 	} `json:"meta,omitempty"`
 }
 
+// QuakeService is a service item of the Quake service data
+type QuakeService struct {
+	Service struct {
+		Name     string `json:"name"`     // service name, e.g. http/ssl
+		Product  string `json:"product"`  // product of the service
+		Version  string `json:"version"`  // version of the product
+		Response string `json:"response"` // banner of the service
+		Cert     string `json:"cert"`     // tls certificate in text
+		TLS      struct {
+			HandshakeLog struct {
+				ServerCertificates struct {
+					Certificate struct {
+						Parsed QuakeCertificate `json:"parsed"`
+					} `json:"certificate"`
+				} `json:"server_certificates"`
+			} `json:"handshake_log"`
+		} `json:"tls"`
+		Http struct {
+			Host            string          `json:"host"`
+			Title           string          `json:"title"`
+			MetaKeywords    string          `json:"meta_keywords"`
+			XPoweredBy      string          `json:"x_powered_by"`
+			HttpLoadUrl     []string        `json:"http_load_url"`
+			Robots          string          `json:"robots"`
+			SitemapHash     string          `json:"sitemap_hash"`
+			Server          string          `json:"server"`
+			Body            string          `json:"body"`
+			RobotsHash      string          `json:"robots_hash"`
+			Sitemap         string          `json:"sitemap"`
+			Path            string          `json:"path"`
+			SecurityText    string          `json:"security_text"`
+			StatusCode      int             `json:"status_code"`
+			ResponseHeaders string          `json:"response_headers"`
+			Icp             json.RawMessage `json:"icp"` // decoded by ICP, so a malformed record doesn't fail the page
+		} `json:"http,omitempty"`
+	} `json:"service,omitempty"`
+	Components []QuakeComponent `json:"components"`
+	Location   QuakeLocation    `json:"location"`
+	Port       int              `json:"port"`
+	Transport  string           `json:"transport"`
+	Asn        int              `json:"asn"`
+	Org        string           `json:"org"`
+	OsName     string           `json:"os_name"`
+	OsVersion  string           `json:"os_version"`
+	IP         string           `json:"ip"`
+	Hostname   string           `json:"hostname"`
+	Domain     string           `json:"domain"`
+	Time       string           `json:"time"` // when the service was scanned
+}
+
+// QuakeICP is the ICP record of a service website
+type QuakeICP struct {
+	Licence     string `json:"licence"` // licence of the website, like 京ICP证030173号-1
+	Domain      string `json:"domain"`
+	UpdateTime  string `json:"update_time"`
+	IsExpired   bool   `json:"is_expired"`
+	MainLicence struct {
+		Licence string `json:"licence"` // licence of the unit, like 京ICP证030173号
+		Unit    string `json:"unit"`    // like 北京百度网讯科技有限公司
+		Nature  string `json:"nature"`  // nature of the unit, like 企业
+	} `json:"main_licence"`
+}
+
+// ICP decodes the ICP record of the service, a zero record is returned if there's none.
+// The fields of a malformed record which decode are returned with the error, the others are empty
+func (s *QuakeService) ICP() (QuakeICP, error) {
+	var icp QuakeICP
+	raw := s.Service.Http.Icp
+	if len(raw) == 0 || string(raw) == "null" {
+		return icp, nil
+	}
+	err := json.Unmarshal(raw, &icp)
+	return icp, err
+}
+
+// QuakeCertificate is the parsed tls certificate of a service
+type QuakeCertificate struct {
+	SubjectDN string `json:"subject_dn"`
+	IssuerDN  string `json:"issuer_dn"`
+	Validity  struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	} `json:"validity"`
+	Extensions struct {
+		SubjectAltName struct {
+			DNSNames []string `json:"dns_names"`
+		} `json:"subject_alt_name"`
+	} `json:"extensions"`
+}
+
+// QuakeComponent is a product fingerprinted on a service
+type QuakeComponent struct {
+	ProductNameCN  string   `json:"product_name_cn"`
+	ProductNameEN  string   `json:"product_name_en"`
+	ProductVendor  string   `json:"product_vendor"`
+	ProductCatalog []string `json:"product_catalog"`
+	ProductType    []string `json:"product_type"`
+	Version        string   `json:"version"`
+}
+
+// QuakeLocation is the location of a service ip
+type QuakeLocation struct {
+	CountryCN  string `json:"country_cn"`
+	CountryEN  string `json:"country_en"`
+	ProvinceCN string `json:"province_cn"`
+	ProvinceEN string `json:"province_en"`
+	CityCN     string `json:"city_cn"`
+	CityEN     string `json:"city_en"`
+	Isp        string `json:"isp"`
+	Owner      string `json:"owner"`
+}
+
 // NewQuakeSearchResult construct of QuakeSearchResult struct
 func NewQuakeSearchResult() *QuakeSearchResult {
 	return &QuakeSearchResult{}
 }
+
+// quakeRawItems returns the original items of a search response body, or nil if it can't be decoded
+func quakeRawItems(body []byte) []json.RawMessage {
+	var raw struct {
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil
+	}
+	return raw.Data
+}
@@ -0,0 +1,41 @@
+package quake
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestQuakeServiceICP(t *testing.T) {
+	tests := []struct {
+		name        string
+		icp         string
+		wantUnit    string
+		wantLicence string
+		wantErr     bool
+	}{
+		{"valid", `{"licence":"京ICP证030173号-1","is_expired":false,"main_licence":{"licence":"京ICP证030173号","unit":"北京百度网讯科技有限公司","nature":"企业"}}`, "北京百度网讯科技有限公司", "京ICP证030173号-1", false},
+		{"no main licence", `{"licence":"京ICP证030173号-1"}`, "", "京ICP证030173号-1", false},
+		{"mistyped field", `{"licence":"京ICP证030173号-1","is_expired":"no","main_licence":{"unit":"北京百度网讯科技有限公司"}}`, "北京百度网讯科技有限公司", "京ICP证030173号-1", true},
+		{"mistyped unit", `{"licence":"京ICP证030173号-1","main_licence":{"unit":3}}`, "", "京ICP证030173号-1", true},
+		{"string", `"京ICP证030173号"`, "", "", true},
+		{"array", `[]`, "", "", true},
+		{"null", `null`, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"message":"Successful.","data":[{"service":{"http":{"icp":` + tt.icp + `}}}]}`
+			result := NewQuakeSearchResult()
+			if err := json.Unmarshal([]byte(body), result); err != nil {
+				t.Fatalf("a malformed icp fails the response: %v", err)
+			}
+
+			icp, err := result.Data[0].ICP()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ICP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if icp.MainLicence.Unit != tt.wantUnit || icp.Licence != tt.wantLicence {
+				t.Errorf("ICP() = %q, %q, want %q, %q", icp.MainLicence.Unit, icp.Licence, tt.wantUnit, tt.wantLicence)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package sources
+
+import "time"
+
+// Quota is the quota of a provider account, as reported by the last provider API response
+type Quota struct {
+	Remaining int       // points left
+	Consumed  int       // points consumed by the last request
+	UpdatedAt time.Time // when the quota was reported, zero if it's unknown yet
+}
+
+// Known reports whether the provider has reported the quota yet
+func (q Quota) Known() bool {
+	return !q.UpdatedAt.IsZero()
+}
+
+// QuotaReporter is a provider which reports the quota of its account
+type QuotaReporter interface {
+	// Quota returns the last reported quota of the account
+	Quota() Quota
+}
@@ -0,0 +1,67 @@
+package sources
+
+import (
+	"strings"
+	"sync"
+)
+
+// ProviderInfo describes a provider to the registry
+type ProviderInfo struct {
+	// Name is the name of the provider, e.g. FOFA, it's matched case-insensitively
+	Name string
+
+	// New creates a provider, each engine has its own
+	New func() Provider
+}
+
+var (
+	providerMu sync.RWMutex
+	providers  []ProviderInfo
+)
+
+// RegisterProvider makes the provider available by its name, a registered name is replaced.
+// A provider package registers itself in its init function
+func RegisterProvider(info ProviderInfo) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	for i := range providers {
+		if strings.EqualFold(providers[i].Name, info.Name) {
+			providers[i] = info
+			return
+		}
+	}
+	providers = append(providers, info)
+}
+
+// LookupProvider returns the registered provider of the name
+func LookupProvider(name string) (ProviderInfo, bool) {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	for _, info := range providers {
+		if strings.EqualFold(info.Name, name) {
+			return info, true
+		}
+	}
+	return ProviderInfo{}, false
+}
+
+// LookupGrammar returns the grammar of the registered provider of the name,
+// nil when it's not registered or can't translate queries
+func LookupGrammar(name string) *Grammar {
+	info, ok := LookupProvider(name)
+	if !ok {
+		return nil
+	}
+	return info.New().Grammar()
+}
+
+// Providers returns the names of the registered providers, in registration order
+func Providers() []string {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for _, info := range providers {
+		names = append(names, info.Name)
+	}
+	return names
+}
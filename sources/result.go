@@ -1,5 +1,12 @@
 package sources
 
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
 // Result is a struct for storing results from providers
 type Result struct {
 	IP         string
@@ -9,4 +16,153 @@ type Result struct {
 	Port       int
 	ICPUnit    string // ICP unit,like 北京百度网讯科技有限公
 	ICPLicence string // ICP licence, like 京ICP证030173号
+
+	Title      string      // html title
+	StatusCode int         // http status code
+	Server     string      // http server header
+	Protocol   string      // application protocol, e.g. http, ssh
+	Transport  string      // transport protocol, tcp or udp
+	Components []Component // products and versions fingerprinted on the service
+	OS         string      // operating system
+	Banner     string      // service banner
+	Cert       Certificate // tls certificate of the service, zero if none
+
+	Country string // ISO 3166-1 alpha-2 code, e.g. CN, or the provider value when the country is unknown
+	Region  string // province or state
+	City    string
+	ASN     int    // autonomous system number
+	Org     string // organization owning the ip
+	ISP     string
+
+	Timestamp time.Time // when the provider last saw the service, zero if unknown
+	Provider  string    // name of the provider which returned the result
+
+	// Raw is the original item of the provider response,
+	// it's only set when the query asks for it with IncludeRaw
+	Raw json.RawMessage
+
+	// Sources is the providers which found the result, one entry per provider
+	Sources []Source
+}
+
+// Component is a product fingerprinted on a service
+type Component struct {
+	Name    string
+	Version string
+}
+
+// Certificate is the tls certificate of a service
+type Certificate struct {
+	Subject   string   // subject distinguished name
+	Issuer    string   // issuer distinguished name
+	SANs      []string // subject alternative dns names
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// IsZero reports whether no certificate is set
+func (c Certificate) IsZero() bool {
+	return c.Subject == "" && c.Issuer == "" && len(c.SANs) == 0 && c.NotBefore.IsZero() && c.NotAfter.IsZero()
+}
+
+// Source records a provider which found a result
+type Source struct {
+	Provider string
+	SeenAt   time.Time // when the result was received from the provider
+}
+
+// Merge fills the empty fields of the result from other, and adds the sources of other
+// which are not in the result yet
+func (r *Result) Merge(other Result) {
+	mergeString(&r.IP, other.IP)
+	mergeString(&r.URL, other.URL)
+	mergeString(&r.Host, other.Host)
+	mergeString(&r.Domain, other.Domain)
+	if r.Port == 0 {
+		r.Port = other.Port
+	}
+	mergeString(&r.ICPUnit, other.ICPUnit)
+	mergeString(&r.ICPLicence, other.ICPLicence)
+	mergeString(&r.Title, other.Title)
+	if r.StatusCode == 0 {
+		r.StatusCode = other.StatusCode
+	}
+	mergeString(&r.Server, other.Server)
+	mergeString(&r.Protocol, other.Protocol)
+	mergeString(&r.Transport, other.Transport)
+	if len(r.Components) == 0 {
+		r.Components = other.Components
+	}
+	mergeString(&r.OS, other.OS)
+	mergeString(&r.Banner, other.Banner)
+	if r.Cert.IsZero() {
+		r.Cert = other.Cert
+	}
+	mergeString(&r.Country, other.Country)
+	mergeString(&r.Region, other.Region)
+	mergeString(&r.City, other.City)
+	if r.ASN == 0 {
+		r.ASN = other.ASN
+	}
+	mergeString(&r.Org, other.Org)
+	mergeString(&r.ISP, other.ISP)
+	if other.Timestamp.After(r.Timestamp) {
+		r.Timestamp = other.Timestamp
+	}
+	mergeString(&r.Provider, other.Provider)
+	if r.Raw == nil {
+		r.Raw = other.Raw
+	}
+
+	for _, source := range other.Sources {
+		r.AddSource(source)
+	}
+}
+
+// AddSource records the provider which found the result, unless it's recorded already
+func (r *Result) AddSource(source Source) {
+	for _, s := range r.Sources {
+		if s.Provider == source.Provider {
+			return
+		}
+	}
+	r.Sources = append(r.Sources, source)
+}
+
+// Confirmations returns the number of providers which found the result
+func (r *Result) Confirmations() int {
+	return len(r.Sources)
+}
+
+// RankByConfirmations sorts the results by the number of providers which found them, most first,
+// results found by as many providers keep their order
+func RankByConfirmations(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Confirmations() > results[j].Confirmations()
+	})
+}
+
+// timeLayouts is the time formats of the provider responses
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime parses a time of a provider response, the zero time is returned if it can't be parsed
+func ParseTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func mergeString(dst *string, value string) {
+	if *dst == "" {
+		*dst = value
+	}
 }
@@ -0,0 +1,61 @@
+package sources
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResultMerge(t *testing.T) {
+	older := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	fofa := Source{Provider: "FOFA", SeenAt: older}
+	quake := Source{Provider: "QUAKE", SeenAt: newer}
+
+	tests := []struct {
+		name   string
+		result Result
+		other  Result
+		want   Result
+	}{
+		{
+			name:   "fill empty fields",
+			result: Result{IP: "1.1.1.1", Port: 80, Provider: "FOFA", Timestamp: older, Sources: []Source{fofa}},
+			other: Result{
+				IP: "1.1.1.1", Port: 80, Title: "login", StatusCode: 200, ASN: 13335, Country: "US",
+				Components: []Component{{Name: "nginx"}}, Cert: Certificate{Subject: "example.com"},
+				Raw: json.RawMessage(`{}`), Provider: "QUAKE", Timestamp: newer, Sources: []Source{quake},
+			},
+			want: Result{
+				IP: "1.1.1.1", Port: 80, Title: "login", StatusCode: 200, ASN: 13335, Country: "US",
+				Components: []Component{{Name: "nginx"}}, Cert: Certificate{Subject: "example.com"},
+				Raw: json.RawMessage(`{}`), Provider: "FOFA", Timestamp: newer, Sources: []Source{fofa, quake},
+			},
+		},
+		{
+			name:   "keep set fields",
+			result: Result{Title: "a", Port: 80, Components: []Component{{Name: "nginx"}}, Cert: Certificate{Issuer: "ca"}, Timestamp: newer},
+			other:  Result{Title: "b", Port: 443, Components: []Component{{Name: "apache"}}, Cert: Certificate{Issuer: "other"}, Timestamp: older},
+			want:   Result{Title: "a", Port: 80, Components: []Component{{Name: "nginx"}}, Cert: Certificate{Issuer: "ca"}, Timestamp: newer},
+		},
+		{
+			name:   "sources deduplicated",
+			result: Result{Sources: []Source{fofa}},
+			other:  Result{Sources: []Source{{Provider: "FOFA", SeenAt: newer}, quake}},
+			want:   Result{Sources: []Source{fofa, quake}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.result
+			got.Merge(tt.other)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Merge() = %+v, want %+v", got, tt.want)
+			}
+			if got.Confirmations() != len(tt.want.Sources) {
+				t.Errorf("Confirmations() = %d, want %d", got.Confirmations(), len(tt.want.Sources))
+			}
+		})
+	}
+}
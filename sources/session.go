@@ -7,6 +7,27 @@ type Session struct {
 	QuakeToken string
 	FofaKey    string
 	HunterKey  string
+
+	// Keys is the credential of each provider by its session key, e.g. fofa,
+	// the fields above are used for the built-in providers when their key isn't set
+	Keys map[string]string
+}
+
+// Key returns the credential of the provider session key, e.g. fofa
+func (s *Session) Key(sessionKey string) string {
+	if key := s.Keys[sessionKey]; key != "" {
+		return key
+	}
+	switch sessionKey {
+	case "quake":
+		return s.QuakeToken
+	case "fofa":
+		return s.FofaKey
+	case "hunter":
+		return s.HunterKey
+	default:
+		return ""
+	}
 }
 
 const (
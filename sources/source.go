@@ -1,5 +1,11 @@
 package sources
 
+import (
+	"context"
+	"maps"
+	"strings"
+)
+
 // Query is the struct for storing the query
 // You can set corresponding query for different providers
 type Query struct {
@@ -8,6 +14,74 @@ type Query struct {
 	FofaQuery     string `json:"fofa_query"`      // input query to fofa query grammar
 	HunterQuery   string `json:"hunter_query"`    // input query to hunter query grammar
 	NumberOfQuery int    `json:"number_of_query"` // number of query, when use deep search mode, unlimited query number
+
+	// Queries is the input query of the other providers, by provider name
+	Queries map[string]string `json:"queries,omitempty"`
+
+	// IncludeRaw asks the providers to keep the original item of each result in Result.Raw
+	IncludeRaw bool `json:"include_raw,omitempty"`
+}
+
+// Native returns the provider specific query of the provider name, e.g. FofaQuery for FOFA,
+// then the query of the name in Queries
+func (q *Query) Native(name string) string {
+	if field := q.nativeField(name); field != nil && *field != "" {
+		return *field
+	}
+	if query, ok := q.Queries[name]; ok {
+		return query
+	}
+	for n, query := range q.Queries {
+		if strings.EqualFold(n, name) {
+			return query
+		}
+	}
+	return ""
+}
+
+// SetNative sets the provider specific query of the provider name,
+// Queries is copied so a copy of the query can be changed on its own
+func (q *Query) SetNative(name, query string) {
+	if field := q.nativeField(name); field != nil {
+		*field = query
+		return
+	}
+	queries := maps.Clone(q.Queries)
+	if queries == nil {
+		queries = make(map[string]string, 1)
+	}
+	for n := range queries {
+		if strings.EqualFold(n, name) {
+			delete(queries, n)
+		}
+	}
+	queries[name] = query
+	q.Queries = queries
+}
+
+// natives returns the names of the providers which have a specific query
+func (q *Query) natives() []string {
+	names := []string{"QUAKE", "FOFA", "HUNTER"}
+	for name := range q.Queries {
+		if q.nativeField(name) == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// nativeField returns the field of the built-in provider specific query, or nil
+func (q *Query) nativeField(name string) *string {
+	switch strings.ToUpper(name) {
+	case "QUAKE":
+		return &q.QuakeQuery
+	case "FOFA":
+		return &q.FofaQuery
+	case "HUNTER":
+		return &q.HunterQuery
+	default:
+		return nil
+	}
 }
 
 // Provider is the interface for all providers
@@ -15,9 +89,63 @@ type Provider interface {
 	// Name returns the name of the provider
 	Name() string
 
-	// Auth checks if the provider is valid to use
-	Auth(*Session) bool
+	// Auth checks if the provider is valid to use, false with a nil error means the key is rejected.
+	// An error means the key couldn't be checked, e.g. a network error or a 5xx response
+	Auth(context.Context, *Session) (bool, error)
+
+	// Search the result with provider, the search stops and the stream is closed
+	// once the context is done
+	Search(context.Context, *Query) (*Stream, error)
+
+	// Grammar returns the grammar which translates the neutral query for the provider
+	Grammar() *Grammar
+
+	// PageSize returns the page size to fetch numberOfQuery results,
+	// numberOfQuery -1 means unlimited
+	PageSize(numberOfQuery int) int
+}
+
+// Configurable is a provider which takes options, e.g. fofa.Options,
+// the engine configures it with WithProviderOptions before any search
+type Configurable interface {
+	// Configure sets the options of the provider, an error is returned for options of another provider
+	Configure(options interface{}) error
+}
+
+// Stream is a running search of a provider
+type Stream struct {
+	// Results receives the results, it's closed when the search ends
+	Results chan *Result
+
+	err      error
+	warnings []string
+}
+
+// NewStream returns a stream to send the results of a search to
+func NewStream() *Stream {
+	return &Stream{Results: make(chan *Result)}
+}
+
+// Close records why the search ended, nil when it completed, and closes Results.
+// It's called once by the provider
+func (s *Stream) Close(err error) {
+	s.err = err
+	close(s.Results)
+}
+
+// Warn records a warning of the search, e.g. a query syntax prompt of the provider.
+// It's called by the provider before Close
+func (s *Stream) Warn(warning string) {
+	s.warnings = append(s.warnings, warning)
+}
+
+// Warnings returns the warnings of the search, it's valid once Results is closed
+func (s *Stream) Warnings() []string {
+	return s.warnings
+}
 
-	// Search the result with provider
-	Search(*Query) (chan *Result, error)
+// Err returns why the search ended, nil when it completed.
+// It's valid once Results is closed
+func (s *Stream) Err() error {
+	return s.err
 }
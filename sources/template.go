@@ -0,0 +1,118 @@
+package sources
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Execute returns a copy of the query with the {{name}} placeholders of the neutral
+// and provider specific queries replaced by vars, e.g. domain:"{{target}}".
+// A placeholder between double quotes is escaped with the grammar of its query,
+// a placeholder out of quotes is quoted unless the value is a single word.
+// Provider specific queries use the grammar of the same name, or the grammar of the registered
+// provider, or the default escaping
+func (q Query) Execute(vars map[string]string, grammars ...*Grammar) (Query, error) {
+	var err error
+	if q.Query, err = executeTemplate(q.Query, vars, nil); err != nil {
+		return q, err
+	}
+
+	for _, name := range q.natives() {
+		native := q.Native(name)
+		if native == "" {
+			continue
+		}
+		grammar := LookupGrammar(name)
+		for _, g := range grammars {
+			if strings.EqualFold(g.Name, name) {
+				grammar = g
+			}
+		}
+		if native, err = executeTemplate(native, vars, grammar); err != nil {
+			return q, fmt.Errorf("%s query: %w", name, err)
+		}
+		q.SetNative(name, native)
+	}
+	return q, nil
+}
+
+// executeTemplate replaces the placeholders of the template
+func executeTemplate(template string, vars map[string]string, grammar *Grammar) (string, error) {
+	if !strings.Contains(template, "{{") {
+		return template, nil
+	}
+
+	var (
+		sb     strings.Builder
+		quoted bool
+	)
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(template):
+			sb.WriteByte(c)
+			sb.WriteByte(template[i+1])
+			i++
+		case c == '"':
+			quoted = !quoted
+			sb.WriteByte(c)
+		case strings.HasPrefix(template[i:], "{{"):
+			end := strings.Index(template[i:], "}}")
+			if end == -1 {
+				return "", fmt.Errorf("unclosed placeholder at position %d", i)
+			}
+			name := strings.TrimSpace(template[i+2 : i+end])
+			value, ok := vars[name]
+			if !ok {
+				return "", fmt.Errorf("undefined template variable %s", name)
+			}
+
+			switch {
+			case quoted:
+				sb.WriteString(grammar.escape(value))
+			case isWord(value):
+				sb.WriteString(value)
+			default:
+				sb.WriteString(`"` + grammar.escape(value) + `"`)
+			}
+			i += end + 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), nil
+}
+
+// isWord reports whether value can be used without quotes
+func isWord(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if !isWordRune(r) || r == '=' {
+			return false
+		}
+	}
+	switch strings.ToLower(value) {
+	case "and", "or", "not":
+		return false
+	}
+	return true
+}
+
+// ReadTargets reads the targets of a template from reader, one target per line.
+// Empty lines and lines starting with # are ignored
+func ReadTargets(reader io.Reader) ([]string, error) {
+	var targets []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	return targets, scanner.Err()
+}
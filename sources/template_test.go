@@ -0,0 +1,61 @@
+package sources
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExecuteTemplate(t *testing.T) {
+	vars := map[string]string{
+		"target":  "example.com",
+		"keyword": `say "hi"`,
+		"op":      "and",
+		"path":    `C:\web`,
+		"empty":   "",
+	}
+	upper := &Grammar{Escape: strings.ToUpper}
+
+	tests := []struct {
+		name     string
+		template string
+		grammar  *Grammar
+		want     string
+	}{
+		{"no placeholder", `title:"{login}"`, nil, `title:"{login}"`},
+		{"quoted", `domain:"{{target}}"`, nil, `domain:"example.com"`},
+		{"spaces in name", `domain:"{{ target }}"`, nil, `domain:"example.com"`},
+		{"quoted escaped", `title:"{{keyword}}"`, nil, `title:"say \"hi\""`},
+		{"quoted backslash", `body:"{{path}}"`, nil, `body:"C:\\web"`},
+		{"bare word", `domain:{{target}}`, nil, `domain:example.com`},
+		{"bare quoted", `title:{{keyword}}`, nil, `title:"say \"hi\""`},
+		{"bare keyword", `title:{{op}}`, nil, `title:"and"`},
+		{"bare empty", `domain:{{empty}}`, nil, `domain:""`},
+		{"escaped quote kept", `title:"a \"{{target}}\""`, nil, `title:"a \"example.com\""`},
+		{"several", `domain:"{{target}}" && title:{{keyword}}`, nil, `domain:"example.com" && title:"say \"hi\""`},
+		{"grammar escape", `title="{{target}}"`, upper, `title="EXAMPLE.COM"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := executeTemplate(tt.template, vars, tt.grammar)
+			if err != nil {
+				t.Fatalf("executeTemplate(%q) error = %v", tt.template, err)
+			}
+			if got != tt.want {
+				t.Errorf("executeTemplate(%q) = %s, want %s", tt.template, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteTemplateError(t *testing.T) {
+	tests := map[string]string{
+		`domain:"{{target"`:    "unclosed placeholder at position 8",
+		`domain:"{{missing}}"`: "undefined template variable missing",
+	}
+	for template, want := range tests {
+		_, err := executeTemplate(template, map[string]string{"target": "example.com"}, nil)
+		if err == nil || err.Error() != want {
+			t.Errorf("executeTemplate(%q) error = %v, want %s", template, err, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package sources
 
 import (
+	"context"
 	"time"
 
 	"github.com/imroc/req/v3"
@@ -31,16 +32,26 @@ func (c *Client) SetDevMode(devMode bool) {
 }
 
 func (c *Client) Get(url string, headers map[string]string) (*req.Response, error) {
+	return c.GetWithContext(context.Background(), url, headers)
+}
+
+// GetWithContext sends a GET request which is cancelled with ctx
+func (c *Client) GetWithContext(ctx context.Context, url string, headers map[string]string) (*req.Response, error) {
 	cl := c.cl.Clone()
 	if c.devMode {
 		cl.DevMode()
 	}
 	cl.SetBaseURL(url).SetTimeout(10 * time.Second)
-	resp := cl.SetCommonHeaders(headers).Get().Do()
+	resp := cl.SetCommonHeaders(headers).Get().Do(ctx)
 	return resp, resp.Err
 }
 
 func (c *Client) Post(url string, headers map[string]string, body interface{}) (*req.Response, error) {
+	return c.PostWithContext(context.Background(), url, headers, body)
+}
+
+// PostWithContext sends a POST request which is cancelled with ctx
+func (c *Client) PostWithContext(ctx context.Context, url string, headers map[string]string, body interface{}) (*req.Response, error) {
 	cl := c.cl.Clone()
 	if c.devMode {
 		cl.DevMode()
@@ -49,6 +60,6 @@ func (c *Client) Post(url string, headers map[string]string, body interface{}) (
 	cl.SetCommonHeaders(headers)
 
 	// Todo Post body haven't been wrapped yet
-	resp := cl.Post().SetBodyJsonMarshal(body).Do()
+	resp := cl.Post().SetBodyJsonMarshal(body).Do(ctx)
 	return resp, resp.Err
 }